@@ -0,0 +1,306 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Backend is a source of HID devices, such as the native platform library, an
+// in-memory emulator for tests or a remote device server.
+//
+// Device paths reported by a backend are local to it. The package namespaces them
+// as "name:path" when surfacing them to the user, and strips the prefix before
+// handing them back.
+type Backend interface {
+	// Enumerate returns a list of all the HID devices known to the backend which
+	// match the vendor and product id, zero matching any.
+	Enumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error)
+
+	// Open connects to a previously enumerated HID device of the backend.
+	Open(info DeviceInfo) (Device, error)
+}
+
+// Notifier is an optional interface for backends which can detect devices being
+// attached or detached without polling.
+type Notifier interface {
+	// Notify signals on the returned channel whenever the set of devices known
+	// to the backend may have changed. The channel is closed when the context
+	// is cancelled or notifications stop working.
+	Notify(ctx context.Context) (<-chan struct{}, error)
+}
+
+// Opener is an optional interface for backends which can look up and connect to
+// a device by its identifiers directly, without a prior enumeration. Backends not
+// implementing it are enumerated and the first matching device opened instead.
+type Opener interface {
+	// OpenMatching connects to the first HID device of the backend matching the
+	// vendor id, product id and serial number. An empty serial matches any.
+	OpenMatching(vendorID uint16, productID uint16, serial string) (Device, error)
+}
+
+var (
+	backendsLock sync.RWMutex
+	backends     = make(map[string]Backend)
+)
+
+// Register makes a HID backend available under the given name. Its devices are
+// returned by Enumerate alongside the native ones, with their paths prefixed by
+// "name:". It panics if the name is empty, contains a colon or is already taken.
+func Register(name string, backend Backend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+
+	if name == "" || strings.Contains(name, ":") {
+		panic(fmt.Sprintf("hid: invalid backend name %q", name))
+	}
+	if backend == nil {
+		panic("hid: nil backend registered as " + name)
+	}
+	if _, ok := backends[name]; ok {
+		panic("hid: backend registered twice: " + name)
+	}
+	backends[name] = backend
+}
+
+// Backends returns the names of the registered backends, sorted.
+func Backends() []string {
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+
+	return backendNames()
+}
+
+// backendNames returns the names of the registered backends, sorted. The caller
+// must hold the backends lock.
+func backendNames() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namedBackend is a backend along with the prefix its device paths are namespaced
+// with. The native backend has no prefix.
+type namedBackend struct {
+	prefix  string
+	backend Backend
+}
+
+// activeBackends returns the native backend, if supported, followed by all the
+// registered ones sorted by name.
+func activeBackends() []namedBackend {
+	var active []namedBackend
+	if nativeSupported() {
+		active = append(active, namedBackend{backend: nativeBackend{}})
+	}
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+
+	for _, name := range backendNames() {
+		active = append(active, namedBackend{prefix: name + ":", backend: backends[name]})
+	}
+	return active
+}
+
+// lookupBackend finds the backend owning a namespaced device path, returning it
+// along with the backend local path. Paths of unregistered namespaces belong to
+// the native backend.
+func lookupBackend(path string) (namedBackend, string) {
+	if name, local, ok := strings.Cut(path, ":"); ok {
+		backendsLock.RLock()
+		backend, ok := backends[name]
+		backendsLock.RUnlock()
+
+		if ok {
+			return namedBackend{prefix: name + ":", backend: backend}, local
+		}
+	}
+	return namedBackend{backend: nativeBackend{}}, path
+}
+
+// Supported returns whether this platform is supported by the HID library or not,
+// either natively or through a registered backend. The goal of this method is to
+// allow programatically handling platforms that do not support HID and not having
+// to fall back to build constraints.
+func Supported() bool {
+	return len(activeBackends()) > 0
+}
+
+// Enumerate returns a list of all the HID devices attached to the system which
+// match the vendor and product id:
+//   - If the vendor id is set to 0 then any vendor matches.
+//   - If the product id is set to 0 then any product matches.
+//   - If the vendor and product id are both 0, all HID devices are returned.
+//
+// Devices of all the backends are returned, native ones first. If some backends
+// fail, the devices of the working ones are still returned, along with the error
+// of the first failing backend.
+func Enumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
+	infos, _, err := enumerate(vendorID, productID)
+	return infos, err
+}
+
+// enumerateAvailable is like Enumerate, but it only fails if none of the backends
+// work, so a missing native library does not hide the devices of the others.
+func enumerateAvailable(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
+	infos, worked, err := enumerate(vendorID, productID)
+	if !worked && err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// enumerate lists the devices of all the active backends, returning the first
+// failure along with the devices of the working ones, and whether any worked.
+func enumerate(vendorID uint16, productID uint16) ([]DeviceInfo, bool, error) {
+	var (
+		infos  []DeviceInfo
+		failed error
+		worked bool
+	)
+	for _, active := range activeBackends() {
+		found, err := active.backend.Enumerate(vendorID, productID)
+		if err != nil {
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
+		worked = true
+		for _, info := range found {
+			info.Path = active.prefix + info.Path
+			infos = append(infos, info)
+		}
+	}
+	return infos, worked, failed
+}
+
+// Open connects to a previsouly discovered HID device.
+func (info DeviceInfo) Open() (Device, error) {
+	active, path := lookupBackend(info.Path)
+
+	local := info
+	local.Path = path
+
+	device, err := active.backend.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	return active.wrap(device), nil
+}
+
+// Open connects to the first HID device matching the vendor id, product id and
+// serial number. If the serial number is empty, it's not used for matching.
+//
+// Backends are tried in the same order as by Enumerate. The native one opens the
+// device directly, without enumerating all the attached devices first. If no
+// backend has a matching device, the error of the first one is returned.
+func Open(vendorID uint16, productID uint16, serial string) (Device, error) {
+	var failed error
+	for _, active := range activeBackends() {
+		device, err := active.open(vendorID, productID, serial)
+		if err == nil {
+			return device, nil
+		}
+		if failed == nil {
+			failed = err
+		}
+	}
+	if failed == nil {
+		failed = fmt.Errorf("%w: no device matches %04x:%04x", ErrDeviceNotFound, vendorID, productID)
+	}
+	return nil, failed
+}
+
+// open connects to the first device of the backend matching the vendor id,
+// product id and serial number, directly if the backend is an Opener.
+func (nb namedBackend) open(vendorID uint16, productID uint16, serial string) (Device, error) {
+	if opener, ok := nb.backend.(Opener); ok {
+		device, err := opener.OpenMatching(vendorID, productID, serial)
+		if err != nil {
+			return nil, err
+		}
+		return nb.wrap(device), nil
+	}
+	device, err := openMatching(nb.backend, vendorID, productID, serial)
+	if err != nil {
+		return nil, err
+	}
+	return nb.wrap(device), nil
+}
+
+// openMatching enumerates the devices of a backend and opens the first one with
+// a matching serial number, if any.
+func openMatching(backend Backend, vendorID uint16, productID uint16, serial string) (Device, error) {
+	infos, err := backend.Enumerate(vendorID, productID)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if serial == "" || info.Serial == serial {
+			return backend.Open(info)
+		}
+	}
+	return nil, fmt.Errorf("%w: no device matches %04x:%04x", ErrDeviceNotFound, vendorID, productID)
+}
+
+// wrap namespaces the paths reported by a device opened through the backend. The
+// native backend has no namespace, so its devices are returned as they are.
+func (nb namedBackend) wrap(device Device) Device {
+	if nb.prefix == "" {
+		return device
+	}
+	return &namespacedDevice{Device: device, prefix: nb.prefix}
+}
+
+// namespacedDevice is a device opened through a registered backend, reporting
+// its path with the backend's namespace prefix.
+type namespacedDevice struct {
+	Device
+	prefix string
+}
+
+// Info retrieves the device details from the backend, namespacing the path.
+func (dev *namespacedDevice) Info() (DeviceInfo, error) {
+	info, err := dev.Device.Info()
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	info.Path = dev.prefix + info.Path
+	return info, nil
+}
+
+// nativeBackend is the platform specific backend, selected via build constraints.
+type nativeBackend struct{}
+
+// Enumerate implements Backend, listing the devices of the platform library.
+func (nativeBackend) Enumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
+	return nativeEnumerate(vendorID, productID)
+}
+
+// Open implements Backend, connecting to a device via the platform library.
+func (nativeBackend) Open(info DeviceInfo) (Device, error) {
+	return nativeOpen(info)
+}
+
+// OpenMatching implements Opener, connecting to a device via the platform library
+// without enumerating all the attached devices first.
+func (nativeBackend) OpenMatching(vendorID uint16, productID uint16, serial string) (Device, error) {
+	return nativeOpenMatching(vendorID, productID, serial)
+}
+
+// Notify implements Notifier, subscribing to the operating system's hotplug
+// notifications if available.
+func (nativeBackend) Notify(ctx context.Context) (<-chan struct{}, error) {
+	return hotplugEvents(ctx)
+}
@@ -0,0 +1,215 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testBackend is a static list of devices to register in tests.
+type testBackend struct {
+	devices []DeviceInfo
+	notify  chan struct{}
+	failure error
+}
+
+func (b *testBackend) Enumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
+	if b.failure != nil {
+		return nil, b.failure
+	}
+	var infos []DeviceInfo
+	for _, info := range b.devices {
+		if (vendorID == 0 || info.VendorID == vendorID) && (productID == 0 || info.ProductID == productID) {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+func (b *testBackend) Open(info DeviceInfo) (Device, error) {
+	for _, device := range b.devices {
+		if device.Path == info.Path {
+			return newDevice(info, newFakeHandle()), nil
+		}
+	}
+	return nil, ErrDeviceNotFound
+}
+
+func (b *testBackend) Notify(ctx context.Context) (<-chan struct{}, error) {
+	if b.notify == nil {
+		return nil, errors.New("notifications not supported")
+	}
+	return b.notify, nil
+}
+
+// openerBackend is a test backend opening devices directly, without enumeration.
+type openerBackend struct {
+	*testBackend
+	opened []string // Serial numbers requested to be opened directly
+}
+
+func (b *openerBackend) Enumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
+	return nil, errors.New("enumeration not supported")
+}
+
+func (b *openerBackend) OpenMatching(vendorID uint16, productID uint16, serial string) (Device, error) {
+	b.opened = append(b.opened, serial)
+	for _, info := range b.devices {
+		if info.VendorID == vendorID && info.ProductID == productID && info.Serial == serial {
+			return newDevice(info, newFakeHandle()), nil
+		}
+	}
+	return nil, ErrDeviceNotFound
+}
+
+// registerTest registers a backend for the duration of a single test.
+func registerTest(t *testing.T, name string, backend Backend) {
+	Register(name, backend)
+	t.Cleanup(func() {
+		backendsLock.Lock()
+		defer backendsLock.Unlock()
+
+		delete(backends, name)
+	})
+}
+
+// Tests that devices of registered backends are enumerated with namespaced paths
+// and that opening them is routed back to the right backend.
+func TestBackendDispatch(t *testing.T) {
+	registerTest(t, "test-dispatch-a", &testBackend{devices: []DeviceInfo{
+		{Path: "1", VendorID: 0x1209, ProductID: 0x0001, Serial: "A1"},
+		{Path: "2", VendorID: 0x1209, ProductID: 0x0002, Serial: "A2"},
+	}})
+	registerTest(t, "test-dispatch-b", &testBackend{devices: []DeviceInfo{
+		{Path: "1", VendorID: 0x1209, ProductID: 0x0001, Serial: "B1"},
+	}})
+	// The native backend may be unavailable, the registered ones are listed anyway
+	infos, _ := EnumerateFilter(Filter{VendorID: 0x1209, Serial: "[AB]?"})
+
+	var paths []string
+	for _, info := range infos {
+		paths = append(paths, info.Path)
+	}
+	if want := []string{"test-dispatch-a:1", "test-dispatch-a:2", "test-dispatch-b:1"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("paths mismatch: have %v, want %v", paths, want)
+	}
+	device, err := Open(0x1209, 0x0001, "B1")
+	if err != nil {
+		t.Fatalf("failed to open device: %v", err)
+	}
+	defer device.Close()
+
+	info, err := device.Info()
+	if err != nil {
+		t.Fatalf("failed to retrieve device info: %v", err)
+	}
+	if info.Path != "test-dispatch-b:fake" {
+		t.Errorf("path mismatch: have %s, want %s", info.Path, "test-dispatch-b:fake")
+	}
+	// Missing devices fail with the native error if available, which is not always
+	// classifiable (e.g. libusb), so only check that opening fails
+	if _, err := Open(0x1209, 0x0003, ""); err == nil {
+		t.Errorf("missing device opened")
+	}
+}
+
+// Tests that the failure of a backend is reported, without hiding the devices of
+// the working ones.
+func TestBackendPartialFailure(t *testing.T) {
+	failure := errors.New("backend broken")
+	registerTest(t, "test-partial-a", &testBackend{failure: failure})
+	registerTest(t, "test-partial-b", &testBackend{devices: []DeviceInfo{
+		{Path: "1", VendorID: 0x1209, ProductID: 0x0004},
+	}})
+	infos, err := Enumerate(0x1209, 0x0004)
+	if err == nil {
+		t.Errorf("backend failure not reported")
+	}
+	if len(infos) != 1 || infos[0].Path != "test-partial-b:1" {
+		t.Errorf("devices mismatch: have %v, want test-partial-b:1", infos)
+	}
+	if infos, err := enumerateAvailable(0x1209, 0x0004); err != nil || len(infos) != 1 {
+		t.Errorf("available devices mismatch: have %v, %v, want 1 device", infos, err)
+	}
+}
+
+// Tests that backends implementing Opener are asked to open devices directly,
+// with the results namespaced like enumerated ones.
+func TestBackendOpener(t *testing.T) {
+	backend := &openerBackend{testBackend: &testBackend{devices: []DeviceInfo{
+		{Path: "1", VendorID: 0x1209, ProductID: 0x0005, Serial: "C1"},
+	}}}
+	registerTest(t, "test-opener", backend)
+
+	device, err := Open(0x1209, 0x0005, "C1")
+	if err != nil {
+		t.Fatalf("failed to open device: %v", err)
+	}
+	defer device.Close()
+
+	if want := []string{"C1"}; !reflect.DeepEqual(backend.opened, want) {
+		t.Errorf("direct opens mismatch: have %v, want %v", backend.opened, want)
+	}
+	if info, err := device.Info(); err != nil || info.Path != "test-opener:fake" {
+		t.Errorf("path mismatch: have %s, %v, want %s", info.Path, err, "test-opener:fake")
+	}
+}
+
+// Tests that invalid and duplicate backend registrations are rejected.
+func TestBackendRegisterInvalid(t *testing.T) {
+	registerTest(t, "test-register", &testBackend{})
+
+	for _, name := range []string{"", "test:colon", "test-register"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("name %q: registration did not panic", name)
+				}
+			}()
+			Register(name, &testBackend{})
+		}()
+	}
+}
+
+// Tests that notifications of multiple sources are merged into a single stream.
+func TestBackendNotifications(t *testing.T) {
+	first, second := make(chan struct{}), make(chan struct{})
+	registerTest(t, "test-notify-a", &testBackend{notify: first})
+	registerTest(t, "test-notify-b", &testBackend{notify: second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	merged := notifications(ctx)
+	for i, source := range []chan struct{}{first, second} {
+		source <- struct{}{}
+		select {
+		case <-merged:
+		case <-time.After(time.Second):
+			t.Fatalf("source %d: notification not forwarded", i)
+		}
+	}
+	// Native notifications may also be merged in, which stop only on cancellation
+	close(first)
+	close(second)
+	cancel()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-merged:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("merged notifications not closed after closing sources")
+		}
+	}
+}
@@ -51,9 +51,10 @@ func main() {
 		fmt.Printf("  Serial:       %s\n", hid.Serial)
 		fmt.Printf("  Manufacturer: %s\n", hid.Manufacturer)
 		fmt.Printf("  Product:      %s\n", hid.Product)
-		fmt.Printf("  Usage Page:   %#04x\n", hid.UsagePage)
-		fmt.Printf("  Usage:        %d\n", hid.Usage)
+		fmt.Printf("  Usage Page:   %#04x (%s)\n", hid.UsagePage, hid.UsagePageName())
+		fmt.Printf("  Usage:        %#04x (%s)\n", hid.Usage, hid.UsageName())
 		fmt.Printf("  Interface:    %d\n", hid.Interface)
+		fmt.Printf("  Bus Type:     %s\n", hid.BusType)
 	}
 	fmt.Println(strings.Repeat("=", 128))
 }
@@ -0,0 +1,269 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"fmt"
+	"math"
+)
+
+// Builder assembles a report descriptor item by item, choosing the shortest
+// encoding for each item's data:
+//
+//	desc, err := descriptor.NewBuilder().
+//		UsagePage(0x01).Usage(0x02).
+//		Collection(descriptor.CollectionApplication).
+//		  ...
+//		EndCollection().
+//		Build()
+//
+// Items carrying a value are always encoded with at least one data byte, as some
+// host parsers mishandle zero length data. Signed items (logical and physical
+// ranges, unit exponent) are always encoded in two's complement, so that hosts
+// treating maximums as signed (e.g. Windows) don't misinterpret them.
+type Builder struct {
+	buf   []byte // Items encoded so far
+	depth int    // Number of currently open collections
+	stack int    // Number of currently pushed global states
+	err   error  // First error encountered during building
+}
+
+// NewBuilder creates an empty report descriptor builder.
+func NewBuilder() *Builder {
+	return new(Builder)
+}
+
+// Build returns the assembled report descriptor, or the first error encountered
+// while building it (e.g. unbalanced collections).
+func (b *Builder) Build() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.depth != 0 {
+		return nil, fmt.Errorf("%w: %d collections left open", ErrUnbalancedCollection, b.depth)
+	}
+	return append([]byte{}, b.buf...), nil
+}
+
+// Item appends a short item with the given raw data, without any interpretation.
+func (b *Builder) Item(tag Tag, data []byte) *Builder {
+	switch len(data) {
+	case 0:
+		b.buf = append(b.buf, byte(tag))
+	case 1:
+		b.buf = append(b.buf, byte(tag)|1, data[0])
+	case 2:
+		b.buf = append(b.buf, byte(tag)|2, data[0], data[1])
+	case 4:
+		b.buf = append(b.buf, byte(tag)|3, data[0], data[1], data[2], data[3])
+	default:
+		if b.err == nil {
+			b.err = fmt.Errorf("descriptor: invalid short item data length %d", len(data))
+		}
+	}
+	return b
+}
+
+// LongItem appends a long item with the given tag and data.
+func (b *Builder) LongItem(tag uint8, data []byte) *Builder {
+	if len(data) > 255 {
+		if b.err == nil {
+			b.err = fmt.Errorf("descriptor: long item data too large: %d bytes", len(data))
+		}
+		return b
+	}
+	b.buf = append(b.buf, 0xfe, byte(len(data)), tag)
+	b.buf = append(b.buf, data...)
+	return b
+}
+
+// unsigned appends an item with the shortest encoding of an unsigned value.
+func (b *Builder) unsigned(tag Tag, value uint32) *Builder {
+	switch {
+	case value <= math.MaxUint8:
+		return b.Item(tag, []byte{byte(value)})
+	case value <= math.MaxUint16:
+		return b.Item(tag, []byte{byte(value), byte(value >> 8)})
+	default:
+		return b.Item(tag, []byte{byte(value), byte(value >> 8), byte(value >> 16), byte(value >> 24)})
+	}
+}
+
+// signed appends an item with the shortest two's complement encoding of a value.
+// Values above the signed 32 bit range are encoded as unsigned 32 bit ones.
+func (b *Builder) signed(tag Tag, value int64) *Builder {
+	switch {
+	case value >= math.MinInt8 && value <= math.MaxInt8:
+		return b.Item(tag, []byte{byte(value)})
+	case value >= math.MinInt16 && value <= math.MaxInt16:
+		return b.Item(tag, []byte{byte(value), byte(value >> 8)})
+	case value >= math.MinInt32 && value <= math.MaxUint32:
+		return b.Item(tag, []byte{byte(value), byte(value >> 8), byte(value >> 16), byte(value >> 24)})
+	default:
+		if b.err == nil {
+			b.err = fmt.Errorf("descriptor: value %d out of 32 bit range", value)
+		}
+		return b
+	}
+}
+
+// Input appends an Input main item with the given flags.
+func (b *Builder) Input(flags Flags) *Builder {
+	return b.unsigned(TagInput, uint32(flags))
+}
+
+// Output appends an Output main item with the given flags.
+func (b *Builder) Output(flags Flags) *Builder {
+	return b.unsigned(TagOutput, uint32(flags))
+}
+
+// Feature appends a Feature main item with the given flags.
+func (b *Builder) Feature(flags Flags) *Builder {
+	return b.unsigned(TagFeature, uint32(flags))
+}
+
+// Collection opens a new collection of the given type.
+func (b *Builder) Collection(kind CollectionType) *Builder {
+	b.depth++
+	return b.unsigned(TagCollection, uint32(kind))
+}
+
+// EndCollection closes the innermost open collection.
+func (b *Builder) EndCollection() *Builder {
+	if b.depth == 0 {
+		if b.err == nil {
+			b.err = fmt.Errorf("%w: end collection at offset %d", ErrUnbalancedCollection, len(b.buf))
+		}
+		return b
+	}
+	b.depth--
+	return b.Item(TagEndCollection, nil)
+}
+
+// UsagePage appends a Usage Page global item.
+func (b *Builder) UsagePage(page uint16) *Builder {
+	return b.unsigned(TagUsagePage, uint32(page))
+}
+
+// LogicalMinimum appends a Logical Minimum global item.
+func (b *Builder) LogicalMinimum(min int64) *Builder {
+	return b.signed(TagLogicalMinimum, min)
+}
+
+// LogicalMaximum appends a Logical Maximum global item.
+func (b *Builder) LogicalMaximum(max int64) *Builder {
+	return b.signed(TagLogicalMaximum, max)
+}
+
+// LogicalRange appends a Logical Minimum and a Logical Maximum global item.
+func (b *Builder) LogicalRange(min, max int64) *Builder {
+	return b.LogicalMinimum(min).LogicalMaximum(max)
+}
+
+// PhysicalMinimum appends a Physical Minimum global item.
+func (b *Builder) PhysicalMinimum(min int64) *Builder {
+	return b.signed(TagPhysicalMinimum, min)
+}
+
+// PhysicalMaximum appends a Physical Maximum global item.
+func (b *Builder) PhysicalMaximum(max int64) *Builder {
+	return b.signed(TagPhysicalMaximum, max)
+}
+
+// PhysicalRange appends a Physical Minimum and a Physical Maximum global item.
+func (b *Builder) PhysicalRange(min, max int64) *Builder {
+	return b.PhysicalMinimum(min).PhysicalMaximum(max)
+}
+
+// UnitExponent appends a Unit Exponent global item.
+func (b *Builder) UnitExponent(exp int32) *Builder {
+	return b.signed(TagUnitExponent, int64(exp))
+}
+
+// Unit appends a Unit global item.
+func (b *Builder) Unit(unit uint32) *Builder {
+	return b.unsigned(TagUnit, unit)
+}
+
+// ReportSize appends a Report Size global item.
+func (b *Builder) ReportSize(bits uint32) *Builder {
+	return b.unsigned(TagReportSize, bits)
+}
+
+// ReportCount appends a Report Count global item.
+func (b *Builder) ReportCount(count uint32) *Builder {
+	return b.unsigned(TagReportCount, count)
+}
+
+// ReportID appends a Report ID global item.
+func (b *Builder) ReportID(id uint8) *Builder {
+	if id == 0 && b.err == nil {
+		b.err = fmt.Errorf("descriptor: report id 0 is reserved")
+	}
+	return b.unsigned(TagReportID, uint32(id))
+}
+
+// Push appends a Push global item, saving the current global state.
+func (b *Builder) Push() *Builder {
+	b.stack++
+	return b.Item(TagPush, nil)
+}
+
+// Pop appends a Pop global item, restoring the last pushed global state.
+func (b *Builder) Pop() *Builder {
+	if b.stack == 0 {
+		if b.err == nil {
+			b.err = fmt.Errorf("%w at offset %d", ErrStackUnderflow, len(b.buf))
+		}
+		return b
+	}
+	b.stack--
+	return b.Item(TagPop, nil)
+}
+
+// Usage appends a Usage local item within the current usage page.
+func (b *Builder) Usage(id uint16) *Builder {
+	return b.unsigned(TagUsage, uint32(id))
+}
+
+// ExtendedUsage appends a Usage local item with an explicit usage page, always
+// encoded on 4 bytes.
+func (b *Builder) ExtendedUsage(usage Usage) *Builder {
+	return b.Item(TagUsage, []byte{byte(usage), byte(usage >> 8), byte(usage >> 16), byte(usage >> 24)})
+}
+
+// UsageMinimum appends a Usage Minimum local item within the current usage page.
+func (b *Builder) UsageMinimum(id uint16) *Builder {
+	return b.unsigned(TagUsageMinimum, uint32(id))
+}
+
+// UsageMaximum appends a Usage Maximum local item within the current usage page.
+func (b *Builder) UsageMaximum(id uint16) *Builder {
+	return b.unsigned(TagUsageMaximum, uint32(id))
+}
+
+// UsageRange appends a Usage Minimum and a Usage Maximum local item.
+func (b *Builder) UsageRange(min, max uint16) *Builder {
+	return b.UsageMinimum(min).UsageMaximum(max)
+}
+
+// DesignatorIndex appends a Designator Index local item.
+func (b *Builder) DesignatorIndex(index uint32) *Builder {
+	return b.unsigned(TagDesignatorIndex, index)
+}
+
+// StringIndex appends a String Index local item.
+func (b *Builder) StringIndex(index uint32) *Builder {
+	return b.unsigned(TagStringIndex, index)
+}
+
+// Delimiter appends a Delimiter local item, opening or closing a set.
+func (b *Builder) Delimiter(open bool) *Builder {
+	if open {
+		return b.unsigned(TagDelimiter, 1)
+	}
+	return b.unsigned(TagDelimiter, 0)
+}
@@ -0,0 +1,122 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Tests that the builder reproduces well known descriptors byte for byte.
+func TestBuilderMouse(t *testing.T) {
+	desc, err := NewBuilder().
+		UsagePage(0x01).Usage(0x02).
+		Collection(CollectionApplication).
+		Usage(0x01).
+		Collection(CollectionPhysical).
+		UsagePage(0x09).UsageRange(1, 3).
+		LogicalRange(0, 1).
+		ReportCount(3).ReportSize(1).
+		Input(FlagVariable).
+		ReportCount(1).ReportSize(5).
+		Input(FlagConstant).
+		UsagePage(0x01).Usage(0x30).Usage(0x31).
+		LogicalRange(-127, 127).
+		ReportSize(8).ReportCount(2).
+		Input(FlagVariable | FlagRelative).
+		EndCollection().
+		EndCollection().
+		Build()
+	if err != nil {
+		t.Fatalf("failed to build descriptor: %v", err)
+	}
+	if !bytes.Equal(desc, bootMouse) {
+		t.Errorf("descriptor mismatch:\nhave %x\nwant %x", desc, bootMouse)
+	}
+}
+
+// Tests that the builder picks the shortest encoding for values, and that signed
+// values are encoded so that they round-trip through the parser.
+func TestBuilderRoundtrip(t *testing.T) {
+	raw, err := NewBuilder().
+		UsagePage(0x01).Usage(0x02).
+		Collection(CollectionApplication).
+		ReportID(1).
+		UsagePage(0x09).UsageRange(1, 5).
+		LogicalRange(0, 1).
+		ReportCount(5).ReportSize(1).
+		Input(FlagVariable).
+		ReportCount(1).ReportSize(3).
+		Input(FlagConstant).
+		UsagePage(0x01).Usage(0x30).Usage(0x31).
+		LogicalRange(-2047, 2047).
+		ReportSize(12).ReportCount(2).
+		Input(FlagVariable|FlagRelative).
+		EndCollection().
+		UsagePage(0x0c).Usage(0x01).
+		Collection(CollectionApplication).
+		ReportID(2).
+		UsageRange(0, 0x023c).
+		LogicalRange(0, 0x023c).
+		ReportCount(1).ReportSize(16).
+		Input(0).
+		EndCollection().
+		UsagePage(0xff00).Usage(0x01).
+		Collection(CollectionApplication).
+		ReportID(3).
+		Usage(0x02).
+		LogicalRange(0, 255).
+		ReportSize(8).ReportCount(7).
+		Feature(FlagVariable).
+		EndCollection().
+		Build()
+	if err != nil {
+		t.Fatalf("failed to build descriptor: %v", err)
+	}
+	if !bytes.Equal(raw, numberedReports) {
+		t.Errorf("descriptor mismatch:\nhave %x\nwant %x", raw, numberedReports)
+	}
+	// Ensure values around the encoding boundaries survive parsing
+	tests := []int64{0, 127, 128, 255, 256, 32767, 32768, 65535, 65536, 2147483647, 4294967295}
+	for _, max := range tests {
+		raw, err := NewBuilder().
+			LogicalRange(0, max).PhysicalRange(-max/2-1, max/2).
+			ReportSize(32).ReportCount(1).
+			Input(FlagVariable).
+			Build()
+		if err != nil {
+			t.Fatalf("max %d: failed to build descriptor: %v", max, err)
+		}
+		desc, err := Parse(raw)
+		if err != nil {
+			t.Fatalf("max %d: failed to parse descriptor: %v", max, err)
+		}
+		global := desc.MainItems[0].Global
+		if global.LogicalMinimum != 0 || global.LogicalMaximum != max {
+			t.Errorf("max %d: logical range mismatch: have [%d, %d], want [0, %d]", max, global.LogicalMinimum, global.LogicalMaximum, max)
+		}
+		if global.PhysicalMinimum != -max/2-1 || global.PhysicalMaximum != max/2 {
+			t.Errorf("max %d: physical range mismatch: have [%d, %d], want [%d, %d]", max, global.PhysicalMinimum, global.PhysicalMaximum, -max/2-1, max/2)
+		}
+	}
+}
+
+// Tests that structural mistakes are reported when building.
+func TestBuilderErrors(t *testing.T) {
+	if _, err := NewBuilder().Collection(CollectionApplication).Build(); !errors.Is(err, ErrUnbalancedCollection) {
+		t.Errorf("open collection error mismatch: have %v, want %v", err, ErrUnbalancedCollection)
+	}
+	if _, err := NewBuilder().EndCollection().Build(); !errors.Is(err, ErrUnbalancedCollection) {
+		t.Errorf("stray end collection error mismatch: have %v, want %v", err, ErrUnbalancedCollection)
+	}
+	if _, err := NewBuilder().Pop().Build(); !errors.Is(err, ErrStackUnderflow) {
+		t.Errorf("stray pop error mismatch: have %v, want %v", err, ErrStackUnderflow)
+	}
+	if _, err := NewBuilder().ReportID(0).Build(); err == nil {
+		t.Errorf("reserved report id accepted")
+	}
+}
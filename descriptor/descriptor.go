@@ -0,0 +1,531 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+// Package descriptor parses and interprets USB HID report descriptors.
+//
+// The package is pure Go and does not depend on any platform HID library, so it
+// can be used on any byte slice, be it retrieved from a live device through the
+// hid.Device.GetReportDescriptor method, or captured from one earlier.
+package descriptor
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrStackUnderflow is returned if a Pop item is encountered without a
+	// matching Push.
+	ErrStackUnderflow = errors.New("descriptor: pop without push")
+
+	// ErrUnbalancedCollection is returned if an End Collection item is found
+	// without an open collection, or if collections are left open at the end
+	// of the descriptor.
+	ErrUnbalancedCollection = errors.New("descriptor: unbalanced collection")
+)
+
+// Usage is an extended (32 bit) usage, the high 16 bits of which contain the
+// usage page and the low 16 bits the usage ID within that page.
+type Usage uint32
+
+// NewUsage creates an extended usage from a usage page and a usage ID.
+func NewUsage(page uint16, id uint16) Usage {
+	return Usage(uint32(page)<<16 | uint32(id))
+}
+
+// Page returns the usage page of the usage.
+func (u Usage) Page() uint16 {
+	return uint16(u >> 16)
+}
+
+// ID returns the usage ID within the usage page.
+func (u Usage) ID() uint16 {
+	return uint16(u)
+}
+
+// String implements fmt.Stringer, returning the usage in page:id hex form.
+func (u Usage) String() string {
+	return fmt.Sprintf("%#04x:%#04x", u.Page(), u.ID())
+}
+
+// UsageRange is an inclusive range of usages. Single usages are represented by
+// ranges where Min and Max are equal.
+type UsageRange struct {
+	Min Usage
+	Max Usage
+}
+
+// Count returns the number of usages in the range.
+func (r UsageRange) Count() int {
+	if r.Max < r.Min {
+		return 0
+	}
+	return int(r.Max-r.Min) + 1
+}
+
+// Range is an inclusive range of designator or string indices.
+type Range struct {
+	Min uint32
+	Max uint32
+}
+
+// Global is the global item state in effect when a main item is encountered.
+type Global struct {
+	UsagePage       uint16
+	LogicalMinimum  int64
+	LogicalMaximum  int64
+	PhysicalMinimum int64
+	PhysicalMaximum int64
+	UnitExponent    int32
+	Unit            uint32
+	ReportSize      uint32
+	ReportID        uint8
+	ReportCount     uint32
+}
+
+// Local is the local item state in effect when a main item is encountered. The
+// usages are fully resolved to extended usages.
+type Local struct {
+	Usages      []UsageRange // Usages and usage ranges, in declaration order
+	Designators []Range      // Designator indices and ranges, in declaration order
+	Strings     []Range      // String indices and ranges, in declaration order
+}
+
+// UsageCount returns the total number of usages declared in the local state.
+func (l *Local) UsageCount() int {
+	var count int
+	for _, r := range l.Usages {
+		count += r.Count()
+	}
+	return count
+}
+
+// Usage returns the i-th declared usage, counting into usage ranges. Requests
+// past the declared usages return the last one, as mandated by the HID spec for
+// fields with more report counts than usages. If no usages were declared at all,
+// zero is returned.
+func (l *Local) Usage(i int) Usage {
+	var last Usage
+	for _, r := range l.Usages {
+		count := r.Count()
+		if i < count {
+			return r.Min + Usage(i)
+		}
+		i -= count
+		last = r.Max
+	}
+	return last
+}
+
+// Flags are the data bits of Input, Output and Feature main items.
+type Flags uint32
+
+const (
+	FlagConstant      Flags = 1 << 0 // Data (0) or Constant (1)
+	FlagVariable      Flags = 1 << 1 // Array (0) or Variable (1)
+	FlagRelative      Flags = 1 << 2 // Absolute (0) or Relative (1)
+	FlagWrap          Flags = 1 << 3 // No Wrap (0) or Wrap (1)
+	FlagNonLinear     Flags = 1 << 4 // Linear (0) or Non Linear (1)
+	FlagNoPreferred   Flags = 1 << 5 // Preferred State (0) or No Preferred (1)
+	FlagNullState     Flags = 1 << 6 // No Null Position (0) or Null State (1)
+	FlagVolatile      Flags = 1 << 7 // Non Volatile (0) or Volatile (1)
+	FlagBufferedBytes Flags = 1 << 8 // Bit Field (0) or Buffered Bytes (1)
+)
+
+// flagNames contains the spec names of the cleared and set states of each flag.
+var flagNames = [...][2]string{
+	{"Data", "Constant"},
+	{"Array", "Variable"},
+	{"Absolute", "Relative"},
+	{"No Wrap", "Wrap"},
+	{"Linear", "Non Linear"},
+	{"Preferred State", "No Preferred"},
+	{"No Null Position", "Null State"},
+	{"Non Volatile", "Volatile"},
+	{"Bit Field", "Buffered Bytes"},
+}
+
+// Names returns the spec names of the flags, one for each bit up to and including
+// the highest set one (at least Data, Array and Absolute).
+func (f Flags) Names() []string {
+	last := 2
+	for i := range flagNames {
+		if f&(1<<i) != 0 && i > last {
+			last = i
+		}
+	}
+	names := make([]string, 0, last+1)
+	for i := 0; i <= last; i++ {
+		if f&(1<<i) != 0 {
+			names = append(names, flagNames[i][1])
+		} else {
+			names = append(names, flagNames[i][0])
+		}
+	}
+	return names
+}
+
+// ReportKind is the type of a report, as defined by its main item.
+type ReportKind uint8
+
+const (
+	Input   ReportKind = 1 // Data sent from the device to the host
+	Output  ReportKind = 2 // Data sent from the host to the device
+	Feature ReportKind = 3 // Configuration data exchanged in both directions
+)
+
+// String implements fmt.Stringer, returning the name of the report kind.
+func (k ReportKind) String() string {
+	switch k {
+	case Input:
+		return "Input"
+	case Output:
+		return "Output"
+	case Feature:
+		return "Feature"
+	default:
+		return fmt.Sprintf("ReportKind(%d)", uint8(k))
+	}
+}
+
+// MainItem is an Input, Output or Feature item with the global and local state
+// that was in effect when it was declared.
+type MainItem struct {
+	Kind   ReportKind // Type of the report this item is part of
+	Flags  Flags      // Data bits of the main item
+	Global Global     // Global state when the item was declared
+	Local  Local      // Local state when the item was declared
+	Offset int        // Byte offset of the item in the descriptor
+
+	Collection *Collection // Innermost collection enclosing the item (nil if none)
+}
+
+// CollectionType is the type of a collection, as defined by its main item.
+type CollectionType uint8
+
+const (
+	CollectionPhysical      CollectionType = 0x00
+	CollectionApplication   CollectionType = 0x01
+	CollectionLogical       CollectionType = 0x02
+	CollectionReport        CollectionType = 0x03
+	CollectionNamedArray    CollectionType = 0x04
+	CollectionUsageSwitch   CollectionType = 0x05
+	CollectionUsageModifier CollectionType = 0x06
+)
+
+// String implements fmt.Stringer, returning the name of the collection type.
+func (t CollectionType) String() string {
+	switch t {
+	case CollectionPhysical:
+		return "Physical"
+	case CollectionApplication:
+		return "Application"
+	case CollectionLogical:
+		return "Logical"
+	case CollectionReport:
+		return "Report"
+	case CollectionNamedArray:
+		return "Named Array"
+	case CollectionUsageSwitch:
+		return "Usage Switch"
+	case CollectionUsageModifier:
+		return "Usage Modifier"
+	}
+	if t >= 0x80 {
+		return fmt.Sprintf("Vendor Defined (%#02x)", uint8(t))
+	}
+	return fmt.Sprintf("Reserved (%#02x)", uint8(t))
+}
+
+// Collection is a group of main items and nested collections.
+type Collection struct {
+	Type   CollectionType // Type of the collection
+	Usage  Usage          // First usage declared for the collection
+	Local  Local          // Full local state when the collection was opened
+	Offset int            // Byte offset of the collection item in the descriptor
+
+	Parent      *Collection   // Enclosing collection (nil for top level ones)
+	Collections []*Collection // Nested collections, in declaration order
+	Items       []*MainItem   // Main items directly within, in declaration order
+}
+
+// Descriptor is a parsed HID report descriptor.
+type Descriptor struct {
+	Items       []Item        // Raw items of the descriptor
+	Collections []*Collection // Top level collections, in declaration order
+	MainItems   []*MainItem   // All Input, Output and Feature items, in declaration order
+}
+
+// Parse interprets a raw report descriptor, resolving the global and local item
+// state for each main item and building up the tree of collections.
+func Parse(b []byte) (*Descriptor, error) {
+	items, err := ParseItems(b)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{desc: &Descriptor{Items: items}}
+	for _, item := range items {
+		if err := p.process(item); err != nil {
+			return nil, err
+		}
+	}
+	if p.current != nil {
+		return nil, fmt.Errorf("%w: %d collections left open", ErrUnbalancedCollection, p.depth())
+	}
+	return p.desc, nil
+}
+
+// localUsage is a declared, but not yet resolved usage or usage range. Short
+// usages are only resolved to extended ones when the main item is reached.
+type localUsage struct {
+	min, max         uint32
+	minExt, maxExt   bool
+	pendingRangeHalf bool // Usage Minimum seen, waiting for Usage Maximum
+}
+
+// parser is the state machine interpreting the items of a report descriptor.
+type parser struct {
+	desc *Descriptor
+
+	global Global   // Current global state
+	stack  []Global // Pushed global states
+
+	usages      []localUsage // Current local usages
+	designators []Range      // Current local designators
+	strings     []Range      // Current local strings
+	designator  bool         // Designator Minimum seen, waiting for Designator Maximum
+	string      bool         // String Minimum seen, waiting for String Maximum
+	delimiter   int          // Delimiter nesting depth (0 or 1)
+	delimited   int          // Number of delimited sets closed since the last main item
+
+	current *Collection // Innermost open collection
+}
+
+// depth returns the current collection nesting depth.
+func (p *parser) depth() int {
+	var depth int
+	for c := p.current; c != nil; c = c.Parent {
+		depth++
+	}
+	return depth
+}
+
+// process interprets a single item and updates the parser state.
+func (p *parser) process(item Item) error {
+	if item.Long() {
+		return nil // Long items are reserved, nothing is defined for them
+	}
+	switch item.Type() {
+	case TypeMain:
+		return p.processMain(item)
+	case TypeGlobal:
+		return p.processGlobal(item)
+	case TypeLocal:
+		p.processLocal(item)
+	}
+	return nil
+}
+
+// processMain handles main items, resetting the local state afterwards.
+func (p *parser) processMain(item Item) error {
+	defer p.resetLocal()
+
+	switch item.Tag {
+	case TagInput, TagOutput, TagFeature:
+		main := &MainItem{
+			Kind:       reportKind(item.Tag),
+			Flags:      Flags(item.Unsigned()),
+			Global:     p.global,
+			Local:      p.local(),
+			Offset:     item.Offset,
+			Collection: p.current,
+		}
+		if p.current != nil {
+			p.current.Items = append(p.current.Items, main)
+		}
+		p.desc.MainItems = append(p.desc.MainItems, main)
+
+	case TagCollection:
+		coll := &Collection{
+			Type:   CollectionType(item.Unsigned()),
+			Local:  p.local(),
+			Offset: item.Offset,
+			Parent: p.current,
+		}
+		if len(coll.Local.Usages) > 0 {
+			coll.Usage = coll.Local.Usages[0].Min
+		}
+		if p.current != nil {
+			p.current.Collections = append(p.current.Collections, coll)
+		} else {
+			p.desc.Collections = append(p.desc.Collections, coll)
+		}
+		p.current = coll
+
+	case TagEndCollection:
+		if p.current == nil {
+			return fmt.Errorf("%w: end collection at offset %d", ErrUnbalancedCollection, item.Offset)
+		}
+		p.current = p.current.Parent
+	}
+	return nil
+}
+
+// reportKind maps an Input, Output or Feature main item tag to its report kind.
+func reportKind(tag Tag) ReportKind {
+	switch tag {
+	case TagInput:
+		return Input
+	case TagOutput:
+		return Output
+	default:
+		return Feature
+	}
+}
+
+// processGlobal handles global items, updating or stashing the global state.
+func (p *parser) processGlobal(item Item) error {
+	switch item.Tag {
+	case TagUsagePage:
+		p.global.UsagePage = uint16(item.Unsigned())
+	case TagLogicalMinimum:
+		p.global.LogicalMinimum = int64(item.Signed())
+	case TagLogicalMaximum:
+		p.global.LogicalMaximum = maximum(item, p.global.LogicalMinimum)
+	case TagPhysicalMinimum:
+		p.global.PhysicalMinimum = int64(item.Signed())
+	case TagPhysicalMaximum:
+		p.global.PhysicalMaximum = maximum(item, p.global.PhysicalMinimum)
+	case TagUnitExponent:
+		p.global.UnitExponent = unitExponent(item)
+	case TagUnit:
+		p.global.Unit = item.Unsigned()
+	case TagReportSize:
+		p.global.ReportSize = item.Unsigned()
+	case TagReportID:
+		p.global.ReportID = uint8(item.Unsigned())
+	case TagReportCount:
+		p.global.ReportCount = item.Unsigned()
+	case TagPush:
+		p.stack = append(p.stack, p.global)
+	case TagPop:
+		if len(p.stack) == 0 {
+			return fmt.Errorf("%w at offset %d", ErrStackUnderflow, item.Offset)
+		}
+		p.global = p.stack[len(p.stack)-1]
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+	return nil
+}
+
+// maximum interprets a logical or physical maximum item. The HID spec does not
+// define the signedness of these explicitly, so follow the common convention of
+// treating them as signed only if the matching minimum is negative.
+func maximum(item Item, minimum int64) int64 {
+	if minimum < 0 {
+		return int64(item.Signed())
+	}
+	return int64(item.Unsigned())
+}
+
+// unitExponent interprets a unit exponent item. The spec defines it as a 4 bit
+// two's complement nibble, but many descriptors encode it as a full signed byte,
+// so accept both forms.
+func unitExponent(item Item) int32 {
+	value := item.Signed()
+	if len(item.Data) == 1 && item.Data[0] <= 0x0f {
+		if value >= 8 {
+			value -= 16
+		}
+	}
+	return value
+}
+
+// processLocal handles local items, accumulating the local state.
+func (p *parser) processLocal(item Item) {
+	switch item.Tag {
+	case TagDelimiter:
+		if item.Unsigned() == 1 {
+			p.delimiter++
+		} else if p.delimiter > 0 {
+			p.delimiter--
+			p.delimited++
+		}
+		return
+	}
+	// Only the first set of delimited usages is used, the rest are alternates
+	if p.delimited > 0 && p.delimiter > 0 {
+		return
+	}
+	extended := len(item.Data) == 4
+
+	switch item.Tag {
+	case TagUsage:
+		p.usages = append(p.usages, localUsage{min: item.Unsigned(), max: item.Unsigned(), minExt: extended, maxExt: extended})
+
+	case TagUsageMinimum:
+		p.usages = append(p.usages, localUsage{min: item.Unsigned(), minExt: extended, pendingRangeHalf: true})
+
+	case TagUsageMaximum:
+		if n := len(p.usages); n > 0 && p.usages[n-1].pendingRangeHalf {
+			p.usages[n-1].max, p.usages[n-1].maxExt, p.usages[n-1].pendingRangeHalf = item.Unsigned(), extended, false
+		} else {
+			// Maximum without minimum, treat the range as starting from zero
+			p.usages = append(p.usages, localUsage{max: item.Unsigned(), minExt: extended, maxExt: extended})
+			if extended {
+				p.usages[len(p.usages)-1].min = item.Unsigned() &^ 0xffff
+			}
+		}
+
+	case TagDesignatorIndex:
+		p.designators = append(p.designators, Range{Min: item.Unsigned(), Max: item.Unsigned()})
+	case TagDesignatorMinimum:
+		p.designators, p.designator = append(p.designators, Range{Min: item.Unsigned(), Max: item.Unsigned()}), true
+	case TagDesignatorMaximum:
+		if p.designator {
+			p.designators[len(p.designators)-1].Max, p.designator = item.Unsigned(), false
+		}
+
+	case TagStringIndex:
+		p.strings = append(p.strings, Range{Min: item.Unsigned(), Max: item.Unsigned()})
+	case TagStringMinimum:
+		p.strings, p.string = append(p.strings, Range{Min: item.Unsigned(), Max: item.Unsigned()}), true
+	case TagStringMaximum:
+		if p.string {
+			p.strings[len(p.strings)-1].Max, p.string = item.Unsigned(), false
+		}
+	}
+}
+
+// local resolves the accumulated local state against the current usage page.
+func (p *parser) local() Local {
+	var local Local
+	for _, u := range p.usages {
+		min, max := u.min, u.max
+		if !u.minExt {
+			min = uint32(p.global.UsagePage)<<16 | min&0xffff
+		}
+		if u.pendingRangeHalf {
+			max = min // Usage Minimum without Usage Maximum, degrade to single usage
+		} else if !u.maxExt {
+			max = uint32(p.global.UsagePage)<<16 | max&0xffff
+		}
+		local.Usages = append(local.Usages, UsageRange{Min: Usage(min), Max: Usage(max)})
+	}
+	local.Designators = append(local.Designators, p.designators...)
+	local.Strings = append(local.Strings, p.strings...)
+	return local
+}
+
+// resetLocal clears the local state after a main item.
+func (p *parser) resetLocal() {
+	p.usages = nil
+	p.designators = nil
+	p.strings = nil
+	p.designator = false
+	p.string = false
+	p.delimiter = 0
+	p.delimited = 0
+}
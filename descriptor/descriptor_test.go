@@ -0,0 +1,273 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"errors"
+	"testing"
+)
+
+// bootMouse is the boot protocol mouse descriptor from the HID spec, Appendix E.10.
+var bootMouse = []byte{
+	0x05, 0x01, // Usage Page (Generic Desktop)
+	0x09, 0x02, // Usage (Mouse)
+	0xa1, 0x01, // Collection (Application)
+	0x09, 0x01, //   Usage (Pointer)
+	0xa1, 0x00, //   Collection (Physical)
+	0x05, 0x09, //     Usage Page (Button)
+	0x19, 0x01, //     Usage Minimum (1)
+	0x29, 0x03, //     Usage Maximum (3)
+	0x15, 0x00, //     Logical Minimum (0)
+	0x25, 0x01, //     Logical Maximum (1)
+	0x95, 0x03, //     Report Count (3)
+	0x75, 0x01, //     Report Size (1)
+	0x81, 0x02, //     Input (Data, Variable, Absolute)
+	0x95, 0x01, //     Report Count (1)
+	0x75, 0x05, //     Report Size (5)
+	0x81, 0x01, //     Input (Constant)
+	0x05, 0x01, //     Usage Page (Generic Desktop)
+	0x09, 0x30, //     Usage (X)
+	0x09, 0x31, //     Usage (Y)
+	0x15, 0x81, //     Logical Minimum (-127)
+	0x25, 0x7f, //     Logical Maximum (127)
+	0x75, 0x08, //     Report Size (8)
+	0x95, 0x02, //     Report Count (2)
+	0x81, 0x06, //     Input (Data, Variable, Relative)
+	0xc0, //         End Collection
+	0xc0, //       End Collection
+}
+
+// bootKeyboard is the boot protocol keyboard descriptor from the HID spec,
+// Appendix E.6.
+var bootKeyboard = []byte{
+	0x05, 0x01, // Usage Page (Generic Desktop)
+	0x09, 0x06, // Usage (Keyboard)
+	0xa1, 0x01, // Collection (Application)
+	0x05, 0x07, //   Usage Page (Keyboard)
+	0x19, 0xe0, //   Usage Minimum (224)
+	0x29, 0xe7, //   Usage Maximum (231)
+	0x15, 0x00, //   Logical Minimum (0)
+	0x25, 0x01, //   Logical Maximum (1)
+	0x75, 0x01, //   Report Size (1)
+	0x95, 0x08, //   Report Count (8)
+	0x81, 0x02, //   Input (Data, Variable, Absolute)
+	0x95, 0x01, //   Report Count (1)
+	0x75, 0x08, //   Report Size (8)
+	0x81, 0x01, //   Input (Constant)
+	0x95, 0x05, //   Report Count (5)
+	0x75, 0x01, //   Report Size (1)
+	0x05, 0x08, //   Usage Page (LEDs)
+	0x19, 0x01, //   Usage Minimum (1)
+	0x29, 0x05, //   Usage Maximum (5)
+	0x91, 0x02, //   Output (Data, Variable, Absolute)
+	0x95, 0x01, //   Report Count (1)
+	0x75, 0x03, //   Report Size (3)
+	0x91, 0x01, //   Output (Constant)
+	0x95, 0x06, //   Report Count (6)
+	0x75, 0x08, //   Report Size (8)
+	0x15, 0x00, //   Logical Minimum (0)
+	0x25, 0x65, //   Logical Maximum (101)
+	0x05, 0x07, //   Usage Page (Keyboard)
+	0x19, 0x00, //   Usage Minimum (0)
+	0x29, 0x65, //   Usage Maximum (101)
+	0x81, 0x00, //   Input (Data, Array, Absolute)
+	0xc0, //       End Collection
+}
+
+// Tests that raw items are split correctly, including long items.
+func TestParseItems(t *testing.T) {
+	items, err := ParseItems([]byte{0x05, 0x01, 0x27, 0xff, 0xff, 0x00, 0x00, 0xfe, 0x02, 0x10, 0xaa, 0xbb, 0xc0})
+	if err != nil {
+		t.Fatalf("failed to parse items: %v", err)
+	}
+	if len(items) != 4 {
+		t.Fatalf("item count mismatch: have %d, want 4", len(items))
+	}
+	if items[0].Tag != TagUsagePage || items[0].Unsigned() != 1 {
+		t.Errorf("item 0 mismatch: have %v", items[0])
+	}
+	if items[1].Tag != TagLogicalMaximum || items[1].Unsigned() != 0xffff || items[1].Offset != 2 {
+		t.Errorf("item 1 mismatch: have %v at %d", items[1], items[1].Offset)
+	}
+	if !items[2].Long() || items[2].LongTag != 0x10 || len(items[2].Data) != 2 {
+		t.Errorf("item 2 mismatch: have %v", items[2])
+	}
+	if items[3].Tag != TagEndCollection || len(items[3].Raw) != 1 {
+		t.Errorf("item 3 mismatch: have %v", items[3])
+	}
+	// Short items with the reserved 0xfc tag must not be mistaken for long ones
+	for _, blob := range [][]byte{{0xfc}, {0xfd, 0x01}, {0xff, 0x01, 0x02, 0x03, 0x04}} {
+		items, err := ParseItems(blob)
+		if err != nil || len(items) != 1 {
+			t.Fatalf("reserved %x: parse mismatch: have %v, %v", blob, items, err)
+		}
+		if items[0].Long() || items[0].Tag != 0xfc || items[0].Tag.Known() {
+			t.Errorf("reserved %x: item mismatch: have %v, long %v", blob, items[0], items[0].Long())
+		}
+	}
+	// Truncated descriptors must be rejected
+	for _, blob := range [][]byte{{0x05}, {0x27, 0xff, 0xff}, {0xfe, 0x04, 0x10, 0x00}} {
+		if _, err := ParseItems(blob); !errors.Is(err, ErrTruncated) {
+			t.Errorf("truncated %x: error mismatch: have %v, want %v", blob, err, ErrTruncated)
+		}
+	}
+}
+
+// Tests that signed item data is sign extended from its encoded size.
+func TestItemSigned(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want int32
+	}{
+		{nil, 0},
+		{[]byte{0x81}, -127},
+		{[]byte{0x7f}, 127},
+		{[]byte{0x00, 0x80}, -32768},
+		{[]byte{0xff, 0x7f}, 32767},
+		{[]byte{0xff, 0xff, 0xff, 0xff}, -1},
+	}
+	for _, tt := range tests {
+		if have := (Item{Data: tt.data}).Signed(); have != tt.want {
+			t.Errorf("data %x: signed mismatch: have %d, want %d", tt.data, have, tt.want)
+		}
+	}
+}
+
+// Tests that the boot mouse descriptor is parsed into the expected tree.
+func TestParseBootMouse(t *testing.T) {
+	desc, err := Parse(bootMouse)
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	if len(desc.Collections) != 1 {
+		t.Fatalf("top level collection count mismatch: have %d, want 1", len(desc.Collections))
+	}
+	app := desc.Collections[0]
+	if app.Type != CollectionApplication || app.Usage != NewUsage(0x01, 0x02) {
+		t.Errorf("application collection mismatch: have %v %v", app.Type, app.Usage)
+	}
+	if len(app.Collections) != 1 || len(app.Items) != 0 {
+		t.Fatalf("application children mismatch: have %d collections, %d items", len(app.Collections), len(app.Items))
+	}
+	phys := app.Collections[0]
+	if phys.Type != CollectionPhysical || phys.Usage != NewUsage(0x01, 0x01) || phys.Parent != app {
+		t.Errorf("physical collection mismatch: have %v %v", phys.Type, phys.Usage)
+	}
+	if len(phys.Items) != 3 || len(desc.MainItems) != 3 {
+		t.Fatalf("main item count mismatch: have %d/%d, want 3", len(phys.Items), len(desc.MainItems))
+	}
+	buttons, padding, axes := phys.Items[0], phys.Items[1], phys.Items[2]
+
+	if buttons.Kind != Input || buttons.Flags != FlagVariable || buttons.Collection != phys {
+		t.Errorf("buttons mismatch: have %v %#x", buttons.Kind, buttons.Flags)
+	}
+	if want := (UsageRange{NewUsage(0x09, 1), NewUsage(0x09, 3)}); len(buttons.Local.Usages) != 1 || buttons.Local.Usages[0] != want {
+		t.Errorf("button usages mismatch: have %v, want %v", buttons.Local.Usages, want)
+	}
+	if buttons.Global.ReportSize != 1 || buttons.Global.ReportCount != 3 {
+		t.Errorf("button sizes mismatch: have %d x %d", buttons.Global.ReportCount, buttons.Global.ReportSize)
+	}
+	if padding.Flags != FlagConstant || len(padding.Local.Usages) != 0 {
+		t.Errorf("padding mismatch: have %#x, %v", padding.Flags, padding.Local.Usages)
+	}
+	if axes.Global.LogicalMinimum != -127 || axes.Global.LogicalMaximum != 127 {
+		t.Errorf("axis range mismatch: have [%d, %d]", axes.Global.LogicalMinimum, axes.Global.LogicalMaximum)
+	}
+	if axes.Local.UsageCount() != 2 || axes.Local.Usage(0) != NewUsage(0x01, 0x30) || axes.Local.Usage(1) != NewUsage(0x01, 0x31) {
+		t.Errorf("axis usages mismatch: have %v", axes.Local.Usages)
+	}
+}
+
+// Tests that global state can be pushed and popped, and that unbalanced pops
+// are rejected.
+func TestParsePushPop(t *testing.T) {
+	desc, err := Parse([]byte{
+		0x05, 0x01, // Usage Page (Generic Desktop)
+		0x75, 0x08, // Report Size (8)
+		0xa4,       // Push
+		0x05, 0x09, // Usage Page (Button)
+		0x75, 0x01, // Report Size (1)
+		0x09, 0x01, // Usage (1)
+		0x81, 0x02, // Input (Data, Variable, Absolute)
+		0xb4,       // Pop
+		0x09, 0x30, // Usage (X)
+		0x81, 0x02, // Input (Data, Variable, Absolute)
+	})
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	if have := desc.MainItems[0]; have.Global.ReportSize != 1 || have.Local.Usage(0) != NewUsage(0x09, 0x01) {
+		t.Errorf("pushed state mismatch: have size %d, usage %v", have.Global.ReportSize, have.Local.Usage(0))
+	}
+	if have := desc.MainItems[1]; have.Global.ReportSize != 8 || have.Local.Usage(0) != NewUsage(0x01, 0x30) {
+		t.Errorf("popped state mismatch: have size %d, usage %v", have.Global.ReportSize, have.Local.Usage(0))
+	}
+	if _, err := Parse([]byte{0xb4}); !errors.Is(err, ErrStackUnderflow) {
+		t.Errorf("underflow error mismatch: have %v, want %v", err, ErrStackUnderflow)
+	}
+}
+
+// Tests that extended usages override the usage page, while short usages pick up
+// the usage page in effect at the main item.
+func TestParseExtendedUsages(t *testing.T) {
+	desc, err := Parse([]byte{
+		0x0b, 0x38, 0x02, 0x0c, 0x00, // Usage (Consumer: AC Pan)
+		0x09, 0x30, // Usage (0x30)
+		0x05, 0x01, // Usage Page (Generic Desktop)
+		0x1b, 0x01, 0x00, 0x09, 0x00, // Usage Minimum (Button 1)
+		0x2b, 0x08, 0x00, 0x09, 0x00, // Usage Maximum (Button 8)
+		0x81, 0x02, // Input (Data, Variable, Absolute)
+	})
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	want := []UsageRange{
+		{NewUsage(0x0c, 0x0238), NewUsage(0x0c, 0x0238)},
+		{NewUsage(0x01, 0x30), NewUsage(0x01, 0x30)},
+		{NewUsage(0x09, 0x01), NewUsage(0x09, 0x08)},
+	}
+	have := desc.MainItems[0].Local.Usages
+	if len(have) != len(want) {
+		t.Fatalf("usage count mismatch: have %v, want %v", have, want)
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("usage %d mismatch: have %v, want %v", i, have[i], want[i])
+		}
+	}
+	if count := desc.MainItems[0].Local.UsageCount(); count != 10 {
+		t.Errorf("usage count mismatch: have %d, want 10", count)
+	}
+}
+
+// Tests that unbalanced collections are rejected.
+func TestParseUnbalanced(t *testing.T) {
+	for _, blob := range [][]byte{{0xc0}, {0xa1, 0x01}, bootMouse[:len(bootMouse)-1]} {
+		if _, err := Parse(blob); !errors.Is(err, ErrUnbalancedCollection) {
+			t.Errorf("descriptor %x: error mismatch: have %v, want %v", blob, err, ErrUnbalancedCollection)
+		}
+	}
+}
+
+// Tests that the boot keyboard descriptor splits into input and output items.
+func TestParseBootKeyboard(t *testing.T) {
+	desc, err := Parse(bootKeyboard)
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	kinds := []ReportKind{Input, Input, Output, Output, Input}
+	if len(desc.MainItems) != len(kinds) {
+		t.Fatalf("main item count mismatch: have %d, want %d", len(desc.MainItems), len(kinds))
+	}
+	for i, kind := range kinds {
+		if desc.MainItems[i].Kind != kind {
+			t.Errorf("main item %d: kind mismatch: have %v, want %v", i, desc.MainItems[i].Kind, kind)
+		}
+	}
+	if keys := desc.MainItems[4]; keys.Flags&FlagVariable != 0 || keys.Local.UsageCount() != 102 {
+		t.Errorf("key array mismatch: have flags %#x, %d usages", keys.Flags, keys.Local.UsageCount())
+	}
+}
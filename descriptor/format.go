@@ -0,0 +1,201 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/karalabe/hid/usage"
+)
+
+// Format renders a raw report descriptor as an annotated listing, one item per
+// line with its hex encoding and its decoded meaning, indented by collection:
+//
+//	0x05, 0x01, // Usage Page (Generic Desktop)
+//	0x09, 0x02, // Usage (Mouse)
+//	0xa1, 0x01, // Collection (Application)
+//	0x09, 0x01, //   Usage (Pointer)
+//
+// If the descriptor is truncated, the items up to the damage are still listed,
+// but an error is returned too.
+func Format(b []byte) (string, error) {
+	lines, err := formatLines(b)
+	return strings.Join(lines, "\n") + "\n", err
+}
+
+// FormatGo renders a raw report descriptor as a Go []byte literal, annotated the
+// same way as Format does.
+func FormatGo(b []byte) (string, error) {
+	lines, err := formatLines(b)
+
+	var builder strings.Builder
+	builder.WriteString("[]byte{\n")
+	for _, line := range lines {
+		builder.WriteString("\t" + line + "\n")
+	}
+	builder.WriteString("}\n")
+	return builder.String(), err
+}
+
+// formatLines renders the individual lines of an annotated descriptor listing.
+func formatLines(b []byte) ([]string, error) {
+	items, err := ParseItems(b)
+
+	// Render the hex encodings first to find the widest one for alignment
+	var (
+		encodings = make([]string, len(items))
+		width     int
+	)
+	for i, item := range items {
+		hexes := make([]string, len(item.Raw))
+		for j, c := range item.Raw {
+			hexes[j] = fmt.Sprintf("0x%02x,", c)
+		}
+		encodings[i] = strings.Join(hexes, " ")
+		if len(encodings[i]) > width {
+			width = len(encodings[i])
+		}
+	}
+	// Decode the items, tracking the state needed to resolve names and signs
+	var (
+		state formatState
+		lines = make([]string, len(items))
+	)
+	for i, item := range items {
+		if item.Tag == TagEndCollection && state.depth > 0 {
+			state.depth--
+		}
+		lines[i] = fmt.Sprintf("%-*s // %s%s", width, encodings[i], strings.Repeat("  ", state.depth), state.describe(item))
+		if item.Tag == TagCollection {
+			state.depth++
+		}
+	}
+	return lines, err
+}
+
+// formatState is the subset of the parser state needed to decode item values.
+type formatState struct {
+	depth int // Collection nesting depth
+
+	page        uint16 // Current usage page
+	logicalMin  int64  // Current logical minimum, to decide the maximum's sign
+	physicalMin int64  // Current physical minimum, to decide the maximum's sign
+
+	stack []formatState // Pushed global states
+}
+
+// describe decodes a single item into its human readable form, updating the
+// formatter state along the way.
+func (s *formatState) describe(item Item) string {
+	if item.Long() {
+		return item.String()
+	}
+	switch item.Tag {
+	case TagInput, TagOutput, TagFeature:
+		return fmt.Sprintf("%s (%s)", item.Tag, strings.Join(Flags(item.Unsigned()).Names(), ", "))
+	case TagCollection:
+		return fmt.Sprintf("%s (%s)", item.Tag, CollectionType(item.Unsigned()))
+	case TagPush:
+		s.stack = append(s.stack, formatState{page: s.page, logicalMin: s.logicalMin, physicalMin: s.physicalMin})
+		return item.Tag.String()
+	case TagPop:
+		if n := len(s.stack); n > 0 {
+			s.page, s.logicalMin, s.physicalMin = s.stack[n-1].page, s.stack[n-1].logicalMin, s.stack[n-1].physicalMin
+			s.stack = s.stack[:n-1]
+		}
+		return item.Tag.String()
+	case TagEndCollection:
+		return item.Tag.String()
+
+	case TagUsagePage:
+		s.page = uint16(item.Unsigned())
+		return fmt.Sprintf("%s (%s)", item.Tag, usage.PageName(s.page))
+
+	case TagUsage, TagUsageMinimum, TagUsageMaximum:
+		if len(item.Data) == 4 {
+			page, id := uint16(item.Unsigned()>>16), uint16(item.Unsigned())
+			return fmt.Sprintf("%s (%s: %s)", item.Tag, usage.PageName(page), usage.Name(page, id))
+		}
+		return fmt.Sprintf("%s (%s)", item.Tag, usage.Name(s.page, uint16(item.Unsigned())))
+
+	case TagLogicalMinimum:
+		s.logicalMin = int64(item.Signed())
+		return fmt.Sprintf("%s (%d)", item.Tag, s.logicalMin)
+	case TagPhysicalMinimum:
+		s.physicalMin = int64(item.Signed())
+		return fmt.Sprintf("%s (%d)", item.Tag, s.physicalMin)
+	case TagLogicalMaximum, TagPhysicalMaximum:
+		min := s.logicalMin
+		if item.Tag == TagPhysicalMaximum {
+			min = s.physicalMin
+		}
+		if min < 0 {
+			return fmt.Sprintf("%s (%d)", item.Tag, item.Signed())
+		}
+		return fmt.Sprintf("%s (%d)", item.Tag, item.Unsigned())
+
+	case TagUnitExponent:
+		return fmt.Sprintf("%s (%d)", item.Tag, unitExponent(item))
+	case TagUnit:
+		return fmt.Sprintf("%s (%s)", item.Tag, FormatUnit(item.Unsigned()))
+
+	case TagDelimiter:
+		if item.Unsigned() == 1 {
+			return fmt.Sprintf("%s (Open)", item.Tag)
+		}
+		return fmt.Sprintf("%s (Close)", item.Tag)
+	}
+	if !item.Tag.Known() && len(item.Data) > 0 {
+		return fmt.Sprintf("%s (%#x)", item.Tag, item.Data)
+	}
+	return item.String()
+}
+
+// unitSystems are the names of the unit systems, encoded in the lowest nibble.
+var unitSystems = [...]string{"None", "SI Linear", "SI Rotation", "English Linear", "English Rotation"}
+
+// unitNames are the base unit names for each of the six dimensions encoded in
+// the upper nibbles of a unit, for each of the four defined systems.
+var unitNames = [6][4]string{
+	{"Centimeter", "Radians", "Inch", "Degrees"},
+	{"Gram", "Gram", "Slug", "Slug"},
+	{"Seconds", "Seconds", "Seconds", "Seconds"},
+	{"Kelvin", "Kelvin", "Fahrenheit", "Fahrenheit"},
+	{"Ampere", "Ampere", "Ampere", "Ampere"},
+	{"Candela", "Candela", "Candela", "Candela"},
+}
+
+// FormatUnit decodes a Unit item value into its system and dimensions, e.g.
+// "SI Linear: Centimeter^2 Gram Seconds^-2".
+func FormatUnit(unit uint32) string {
+	system := unit & 0x0f
+	if system == 0 {
+		return "None"
+	}
+	if system >= uint32(len(unitSystems)) {
+		return fmt.Sprintf("%#x", unit)
+	}
+	var dims []string
+	for i := 0; i < 6; i++ {
+		exp := int(unit>>(4*(i+1))) & 0x0f
+		if exp == 0 {
+			continue
+		}
+		if exp >= 8 {
+			exp -= 16
+		}
+		name := unitNames[i][system-1]
+		if exp != 1 {
+			name = fmt.Sprintf("%s^%d", name, exp)
+		}
+		dims = append(dims, name)
+	}
+	if len(dims) == 0 {
+		return unitSystems[system]
+	}
+	return unitSystems[system] + ": " + strings.Join(dims, " ")
+}
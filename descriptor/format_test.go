@@ -0,0 +1,101 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Tests that descriptors are rendered into the annotated listing format.
+func TestFormat(t *testing.T) {
+	want := `0x05, 0x01, // Usage Page (Generic Desktop)
+0x09, 0x02, // Usage (Mouse)
+0xa1, 0x01, // Collection (Application)
+0x09, 0x01, //   Usage (Pointer)
+0xa1, 0x00, //   Collection (Physical)
+0x05, 0x09, //     Usage Page (Button)
+0x19, 0x01, //     Usage Minimum (Button 1)
+0x29, 0x03, //     Usage Maximum (Button 3)
+0x15, 0x00, //     Logical Minimum (0)
+0x25, 0x01, //     Logical Maximum (1)
+0x95, 0x03, //     Report Count (3)
+0x75, 0x01, //     Report Size (1)
+0x81, 0x02, //     Input (Data, Variable, Absolute)
+0x95, 0x01, //     Report Count (1)
+0x75, 0x05, //     Report Size (5)
+0x81, 0x01, //     Input (Constant, Array, Absolute)
+0x05, 0x01, //     Usage Page (Generic Desktop)
+0x09, 0x30, //     Usage (X)
+0x09, 0x31, //     Usage (Y)
+0x15, 0x81, //     Logical Minimum (-127)
+0x25, 0x7f, //     Logical Maximum (127)
+0x75, 0x08, //     Report Size (8)
+0x95, 0x02, //     Report Count (2)
+0x81, 0x06, //     Input (Data, Variable, Relative)
+0xc0,       //   End Collection
+0xc0,       // End Collection
+`
+	have, err := Format(bootMouse)
+	if err != nil {
+		t.Fatalf("failed to format descriptor: %v", err)
+	}
+	if have != want {
+		t.Errorf("listing mismatch:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+// Tests that descriptors are rendered into Go byte slice literals, aligning the
+// comments to the longest item.
+func TestFormatGo(t *testing.T) {
+	want := `[]byte{
+	0x05, 0x0c,                   // Usage Page (Consumer)
+	0x0b, 0x30, 0x00, 0x01, 0x00, // Usage (Generic Desktop: X)
+	0xfe, 0x01, 0x10, 0xaa,       // Long Item (tag 0x10, 1 bytes)
+	0xc5, 0x01,                   // Reserved Global (0xc4) (0x01)
+	0xc4,                         // Reserved Global (0xc4)
+}
+`
+	have, err := FormatGo([]byte{0x05, 0x0c, 0x0b, 0x30, 0x00, 0x01, 0x00, 0xfe, 0x01, 0x10, 0xaa, 0xc5, 0x01, 0xc4})
+	if err != nil {
+		t.Fatalf("failed to format descriptor: %v", err)
+	}
+	if have != want {
+		t.Errorf("literal mismatch:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+// Tests that truncated descriptors are still rendered up to the damage.
+func TestFormatTruncated(t *testing.T) {
+	have, err := Format([]byte{0x05, 0x01, 0x09})
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrTruncated)
+	}
+	if !strings.HasPrefix(have, "0x05, 0x01, // Usage Page (Generic Desktop)") {
+		t.Errorf("partial listing mismatch: have %q", have)
+	}
+}
+
+// Tests that units are decoded into their system and dimensions.
+func TestFormatUnit(t *testing.T) {
+	tests := []struct {
+		unit uint32
+		want string
+	}{
+		{0x00, "None"},
+		{0x11, "SI Linear: Centimeter"},
+		{0x14, "English Rotation: Degrees"},
+		{0xe121, "SI Linear: Centimeter^2 Gram Seconds^-2"},
+		{0x01001001, "SI Linear: Seconds Candela"},
+		{0x07, "0x7"},
+	}
+	for _, tt := range tests {
+		if have := FormatUnit(tt.unit); have != tt.want {
+			t.Errorf("unit %#x: mismatch: have %q, want %q", tt.unit, have, tt.want)
+		}
+	}
+}
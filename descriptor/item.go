@@ -0,0 +1,236 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is returned if the descriptor ends in the middle of an item.
+var ErrTruncated = errors.New("descriptor: truncated item")
+
+// ItemType is the type of a short item, encoded in bits 2-3 of its prefix.
+type ItemType uint8
+
+const (
+	TypeMain     ItemType = 0 // Main items define or group data fields
+	TypeGlobal   ItemType = 1 // Global items change the state for all subsequent items
+	TypeLocal    ItemType = 2 // Local items change the state for the next main item only
+	TypeReserved ItemType = 3 // Reserved, only used by the long item prefix
+)
+
+// String implements fmt.Stringer, returning the name of the item type.
+func (t ItemType) String() string {
+	switch t {
+	case TypeMain:
+		return "Main"
+	case TypeGlobal:
+		return "Global"
+	case TypeLocal:
+		return "Local"
+	default:
+		return "Reserved"
+	}
+}
+
+// Tag is the prefix byte of a short item with the size bits cleared, thus it
+// identifies both the type of the item and its function within that type.
+type Tag uint8
+
+// Main item tags.
+const (
+	TagInput         Tag = 0x80
+	TagOutput        Tag = 0x90
+	TagCollection    Tag = 0xa0
+	TagFeature       Tag = 0xb0
+	TagEndCollection Tag = 0xc0
+)
+
+// Global item tags.
+const (
+	TagUsagePage       Tag = 0x04
+	TagLogicalMinimum  Tag = 0x14
+	TagLogicalMaximum  Tag = 0x24
+	TagPhysicalMinimum Tag = 0x34
+	TagPhysicalMaximum Tag = 0x44
+	TagUnitExponent    Tag = 0x54
+	TagUnit            Tag = 0x64
+	TagReportSize      Tag = 0x74
+	TagReportID        Tag = 0x84
+	TagReportCount     Tag = 0x94
+	TagPush            Tag = 0xa4
+	TagPop             Tag = 0xb4
+)
+
+// Local item tags.
+const (
+	TagUsage             Tag = 0x08
+	TagUsageMinimum      Tag = 0x18
+	TagUsageMaximum      Tag = 0x28
+	TagDesignatorIndex   Tag = 0x38
+	TagDesignatorMinimum Tag = 0x48
+	TagDesignatorMaximum Tag = 0x58
+	TagStringIndex       Tag = 0x78
+	TagStringMinimum     Tag = 0x88
+	TagStringMaximum     Tag = 0x98
+	TagDelimiter         Tag = 0xa8
+)
+
+// TagLong is the prefix of a long item. The actual tag of long items is stored
+// in a separate byte, see Item.LongTag. Its size bits are kept, so no short item
+// (reserved tag 0xfc included) can ever be mistaken for a long one.
+const TagLong Tag = 0xfe
+
+// tagNames maps the known item tags to their names as used in the HID spec.
+var tagNames = map[Tag]string{
+	TagInput:             "Input",
+	TagOutput:            "Output",
+	TagCollection:        "Collection",
+	TagFeature:           "Feature",
+	TagEndCollection:     "End Collection",
+	TagUsagePage:         "Usage Page",
+	TagLogicalMinimum:    "Logical Minimum",
+	TagLogicalMaximum:    "Logical Maximum",
+	TagPhysicalMinimum:   "Physical Minimum",
+	TagPhysicalMaximum:   "Physical Maximum",
+	TagUnitExponent:      "Unit Exponent",
+	TagUnit:              "Unit",
+	TagReportSize:        "Report Size",
+	TagReportID:          "Report ID",
+	TagReportCount:       "Report Count",
+	TagPush:              "Push",
+	TagPop:               "Pop",
+	TagUsage:             "Usage",
+	TagUsageMinimum:      "Usage Minimum",
+	TagUsageMaximum:      "Usage Maximum",
+	TagDesignatorIndex:   "Designator Index",
+	TagDesignatorMinimum: "Designator Minimum",
+	TagDesignatorMaximum: "Designator Maximum",
+	TagStringIndex:       "String Index",
+	TagStringMinimum:     "String Minimum",
+	TagStringMaximum:     "String Maximum",
+	TagDelimiter:         "Delimiter",
+	TagLong:              "Long Item",
+}
+
+// Type returns the item type encoded into the tag.
+func (t Tag) Type() ItemType {
+	return ItemType(t>>2) & 0x03
+}
+
+// Known returns whether the tag is defined by the HID specification.
+func (t Tag) Known() bool {
+	_, ok := tagNames[t]
+	return ok
+}
+
+// String implements fmt.Stringer, returning the name of the tag.
+func (t Tag) String() string {
+	if name, ok := tagNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Reserved %s (%#02x)", t.Type(), uint8(t))
+}
+
+// Item is a single short or long item from a report descriptor.
+type Item struct {
+	Tag     Tag    // Item tag (prefix without the size bits), TagLong for long items
+	LongTag uint8  // Tag of long items, unused for short ones
+	Data    []byte // Data bytes of the item, little endian for short items
+	Offset  int    // Byte offset of the item prefix in the descriptor
+	Raw     []byte // Raw encoded item, including prefix and data bytes
+}
+
+// Type returns the type of the item.
+func (it Item) Type() ItemType {
+	return it.Tag.Type()
+}
+
+// Long returns whether the item is a long item.
+func (it Item) Long() bool {
+	return it.Tag == TagLong
+}
+
+// Unsigned interprets the item data as an unsigned little endian integer.
+func (it Item) Unsigned() uint32 {
+	var value uint32
+	for i := len(it.Data) - 1; i >= 0 && i < 4; i-- {
+		value = value<<8 | uint32(it.Data[i])
+	}
+	return value
+}
+
+// Signed interprets the item data as a signed (two's complement) little endian
+// integer, sign extending it from the encoded data size.
+func (it Item) Signed() int32 {
+	switch len(it.Data) {
+	case 0:
+		return 0
+	case 1:
+		return int32(int8(it.Data[0]))
+	case 2:
+		return int32(int16(it.Unsigned()))
+	default:
+		return int32(it.Unsigned())
+	}
+}
+
+// String implements fmt.Stringer, returning the tag name and the item data.
+func (it Item) String() string {
+	if it.Long() {
+		return fmt.Sprintf("Long Item (tag %#02x, %d bytes)", it.LongTag, len(it.Data))
+	}
+	if len(it.Data) == 0 {
+		return it.Tag.String()
+	}
+	return fmt.Sprintf("%s (%d)", it.Tag, it.Unsigned())
+}
+
+// ParseItems splits a raw report descriptor into its individual items without
+// interpreting them in any way. It only fails if the descriptor is truncated.
+func ParseItems(b []byte) ([]Item, error) {
+	var items []Item
+	for offset := 0; offset < len(b); {
+		prefix := b[offset]
+
+		// Long items have a fixed prefix followed by the size and tag
+		if prefix == 0xfe {
+			if offset+3 > len(b) {
+				return items, fmt.Errorf("%w at offset %d", ErrTruncated, offset)
+			}
+			size := int(b[offset+1])
+			if offset+3+size > len(b) {
+				return items, fmt.Errorf("%w at offset %d", ErrTruncated, offset)
+			}
+			items = append(items, Item{
+				Tag:     TagLong,
+				LongTag: b[offset+2],
+				Data:    b[offset+3 : offset+3+size],
+				Offset:  offset,
+				Raw:     b[offset : offset+3+size],
+			})
+			offset += 3 + size
+			continue
+		}
+		// Short items encode 0, 1, 2 or 4 bytes of data in their lowest 2 bits
+		size := int(prefix & 0x03)
+		if size == 3 {
+			size = 4
+		}
+		if offset+1+size > len(b) {
+			return items, fmt.Errorf("%w at offset %d", ErrTruncated, offset)
+		}
+		items = append(items, Item{
+			Tag:    Tag(prefix &^ 0x03),
+			Data:   b[offset+1 : offset+1+size],
+			Offset: offset,
+			Raw:    b[offset : offset+1+size],
+		})
+		offset += 1 + size
+	}
+	return items, nil
+}
@@ -0,0 +1,203 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"math"
+	"sort"
+)
+
+// Field is a single Input, Output or Feature main item placed within its report.
+// A field contains Count elements of Size bits each, stored consecutively (least
+// significant bit first) starting at Offset. Bogus sizes and counts declared by
+// the descriptor are capped, so they cannot overflow or stall iterations.
+type Field struct {
+	Kind     ReportKind // Type of the report the field is part of
+	ReportID uint8      // Report ID of the report the field is part of
+	Flags    Flags      // Data bits of the main item
+
+	Offset int // Bit offset of the field within the report data (excluding the report ID)
+	Size   int // Size of a single element in bits
+	Count  int // Number of elements in the field
+
+	LogicalMinimum  int64  // Minimum value the device reports
+	LogicalMaximum  int64  // Maximum value the device reports
+	PhysicalMinimum int64  // Minimum value in physical units
+	PhysicalMaximum int64  // Maximum value in physical units
+	Unit            uint32 // Unit of the physical values
+	UnitExponent    int32  // Base 10 exponent of the physical unit
+
+	Usages []UsageRange // Usages associated with the field elements
+	Item   *MainItem    // Main item the field was declared by
+}
+
+// Constant returns whether the field is constant (i.e. padding).
+func (f *Field) Constant() bool {
+	return f.Flags&FlagConstant != 0
+}
+
+// Variable returns whether each element of the field maps to its own usage. If
+// not, the field is an array of usage selectors.
+func (f *Field) Variable() bool {
+	return f.Flags&FlagVariable != 0
+}
+
+// Usage returns the usage of the i-th element of a variable field, or the i-th
+// selectable usage of an array field.
+func (f *Field) Usage(i int) Usage {
+	local := Local{Usages: f.Usages}
+	return local.Usage(i)
+}
+
+// UsageCount returns the number of usages declared for the field.
+func (f *Field) UsageCount() int {
+	local := Local{Usages: f.Usages}
+	return local.UsageCount()
+}
+
+// ReportLayout is the memory layout of a single report.
+type ReportLayout struct {
+	Kind     ReportKind // Type of the report
+	ID       uint8      // Report ID, zero if the descriptor has no numbered reports
+	Numbered bool       // Whether the report data is prefixed by the report ID
+	Bits     int        // Total length of the report data in bits (excluding the report ID)
+	Fields   []*Field   // Fields of the report, in declaration (and bit) order
+}
+
+// Length returns the length of the report data in bytes, excluding the report ID.
+func (r *ReportLayout) Length() int {
+	return (r.Bits + 7) / 8
+}
+
+// Size returns the length of the report in bytes as transferred on the wire,
+// including the report ID prefix only for numbered reports. To size buffers for
+// hidapi, which always expects an ID byte for output and feature reports, use
+// BufferSize instead.
+func (r *ReportLayout) Size() int {
+	if r.Numbered {
+		return r.Length() + 1
+	}
+	return r.Length()
+}
+
+// Layout is the memory layout of all the reports declared by a descriptor.
+type Layout struct {
+	// Numbered is whether the descriptor uses report IDs. If it does, every
+	// report transfer is prefixed by its one byte ID. If not, no ID is sent,
+	// but hidapi still expects a 0x00 report ID as the first byte passed to
+	// Write and SendFeatureReport (and GetFeatureReport).
+	Numbered bool
+
+	// Reports is the list of reports, ordered by kind and report ID.
+	Reports []*ReportLayout
+}
+
+// Layout computes the memory layout of all the reports declared by a descriptor.
+func (d *Descriptor) Layout() *Layout {
+	layout := new(Layout)
+
+	type key struct {
+		kind ReportKind
+		id   uint8
+	}
+	reports := make(map[key]*ReportLayout)
+
+	for _, item := range d.MainItems {
+		if item.Global.ReportID != 0 {
+			layout.Numbered = true
+		}
+		k := key{item.Kind, item.Global.ReportID}
+
+		report, ok := reports[k]
+		if !ok {
+			report = &ReportLayout{Kind: item.Kind, ID: item.Global.ReportID}
+			reports[k] = report
+			layout.Reports = append(layout.Reports, report)
+		}
+		field := &Field{
+			Kind:            item.Kind,
+			ReportID:        item.Global.ReportID,
+			Flags:           item.Flags,
+			Offset:          report.Bits,
+			Size:            saturate(item.Global.ReportSize, maxReportBits),
+			Count:           saturate(item.Global.ReportCount, maxFieldCount),
+			LogicalMinimum:  item.Global.LogicalMinimum,
+			LogicalMaximum:  item.Global.LogicalMaximum,
+			PhysicalMinimum: item.Global.PhysicalMinimum,
+			PhysicalMaximum: item.Global.PhysicalMaximum,
+			Unit:            item.Global.Unit,
+			UnitExponent:    item.Global.UnitExponent,
+			Usages:          item.Local.Usages,
+			Item:            item,
+		}
+		report.Fields = append(report.Fields, field)
+		report.Bits = addBits(report.Bits, item.Global.ReportSize, item.Global.ReportCount)
+	}
+	for _, report := range layout.Reports {
+		report.Numbered = layout.Numbered
+	}
+	sort.SliceStable(layout.Reports, func(i, j int) bool {
+		if layout.Reports[i].Kind != layout.Reports[j].Kind {
+			return layout.Reports[i].Kind < layout.Reports[j].Kind
+		}
+		return layout.Reports[i].ID < layout.Reports[j].ID
+	})
+	return layout
+}
+
+// maxReportBits is the saturation limit of report lengths in bits, well above any
+// valid report but safe from integer overflows, even on 32 bit platforms when it
+// is rounded up to bytes.
+const maxReportBits = math.MaxInt32 - 7
+
+// maxFieldCount is the saturation limit of field element counts, the number of
+// single bit elements fitting into the largest report buffer. Larger counts only
+// come from bogus descriptors, which are rejected when creating their reports.
+const maxFieldCount = MaxReportSize * 8
+
+// saturate converts a descriptor value into an int, capping it at limit instead
+// of overflowing on bogus values.
+func saturate(value uint32, limit int) int {
+	if uint64(value) > uint64(limit) {
+		return limit
+	}
+	return int(value)
+}
+
+// addBits adds the length of a field to a report length, saturating instead of
+// overflowing on bogus sizes and counts.
+func addBits(bits int, size uint32, count uint32) int {
+	total := uint64(bits) + uint64(size)*uint64(count)
+	if total > maxReportBits {
+		return maxReportBits
+	}
+	return int(total)
+}
+
+// Report returns the layout of a specific report, or nil if it's not declared.
+func (l *Layout) Report(kind ReportKind, id uint8) *ReportLayout {
+	for _, report := range l.Reports {
+		if report.Kind == kind && report.ID == id {
+			return report
+		}
+	}
+	return nil
+}
+
+// MaxSize returns the size of the longest report of a specific kind in bytes as
+// exchanged with hidapi, including the report ID byte if the reports are prefixed
+// with it (see ReportLayout.BufferSize). It is the minimum buffer size needed to
+// read any report of the given kind. Input reports fetched via GetInputReport
+// may need one more byte for the report ID, see ReportLayout.ControlSize.
+func (l *Layout) MaxSize(kind ReportKind) int {
+	var size int
+	for _, report := range l.Reports {
+		if report.Kind == kind && report.BufferSize() > size {
+			size = report.BufferSize()
+		}
+	}
+	return size
+}
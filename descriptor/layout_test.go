@@ -0,0 +1,172 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import "testing"
+
+// numberedReports is a composite descriptor with a mouse input report, a 16 bit
+// consumer control input report and a vendor feature report, each numbered.
+var numberedReports = []byte{
+	0x05, 0x01, // Usage Page (Generic Desktop)
+	0x09, 0x02, // Usage (Mouse)
+	0xa1, 0x01, // Collection (Application)
+	0x85, 0x01, //   Report ID (1)
+	0x05, 0x09, //   Usage Page (Button)
+	0x19, 0x01, //   Usage Minimum (1)
+	0x29, 0x05, //   Usage Maximum (5)
+	0x15, 0x00, //   Logical Minimum (0)
+	0x25, 0x01, //   Logical Maximum (1)
+	0x95, 0x05, //   Report Count (5)
+	0x75, 0x01, //   Report Size (1)
+	0x81, 0x02, //   Input (Data, Variable, Absolute)
+	0x95, 0x01, //   Report Count (1)
+	0x75, 0x03, //   Report Size (3)
+	0x81, 0x01, //   Input (Constant)
+	0x05, 0x01, //   Usage Page (Generic Desktop)
+	0x09, 0x30, //   Usage (X)
+	0x09, 0x31, //   Usage (Y)
+	0x16, 0x01, 0xf8, // Logical Minimum (-2047)
+	0x26, 0xff, 0x07, // Logical Maximum (2047)
+	0x75, 0x0c, //   Report Size (12)
+	0x95, 0x02, //   Report Count (2)
+	0x81, 0x06, //   Input (Data, Variable, Relative)
+	0xc0,       // End Collection
+	0x05, 0x0c, // Usage Page (Consumer)
+	0x09, 0x01, // Usage (Consumer Control)
+	0xa1, 0x01, // Collection (Application)
+	0x85, 0x02, //   Report ID (2)
+	0x19, 0x00, //   Usage Minimum (0)
+	0x2a, 0x3c, 0x02, // Usage Maximum (0x023c)
+	0x15, 0x00, //   Logical Minimum (0)
+	0x26, 0x3c, 0x02, // Logical Maximum (0x023c)
+	0x95, 0x01, //   Report Count (1)
+	0x75, 0x10, //   Report Size (16)
+	0x81, 0x00, //   Input (Data, Array, Absolute)
+	0xc0,             // End Collection
+	0x06, 0x00, 0xff, // Usage Page (Vendor Defined 0xff00)
+	0x09, 0x01, // Usage (1)
+	0xa1, 0x01, // Collection (Application)
+	0x85, 0x03, //   Report ID (3)
+	0x09, 0x02, //   Usage (2)
+	0x15, 0x00, //   Logical Minimum (0)
+	0x26, 0xff, 0x00, // Logical Maximum (255)
+	0x75, 0x08, //   Report Size (8)
+	0x95, 0x07, //   Report Count (7)
+	0xb1, 0x02, //   Feature (Data, Variable, Absolute)
+	0xc0, //       End Collection
+}
+
+// Tests that unnumbered report layouts are computed correctly.
+func TestLayoutUnnumbered(t *testing.T) {
+	desc, err := Parse(bootKeyboard)
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	layout := desc.Layout()
+	if layout.Numbered {
+		t.Errorf("keyboard reported as numbered")
+	}
+	if len(layout.Reports) != 2 {
+		t.Fatalf("report count mismatch: have %d, want 2", len(layout.Reports))
+	}
+	input := layout.Report(Input, 0)
+	if input == nil {
+		t.Fatalf("input report missing")
+	}
+	if input.Bits != 64 || input.Length() != 8 || input.Size() != 8 {
+		t.Errorf("input size mismatch: have %d bits, %d bytes, %d transferred", input.Bits, input.Length(), input.Size())
+	}
+	offsets := []int{0, 8, 16}
+	for i, field := range input.Fields {
+		if field.Offset != offsets[i] {
+			t.Errorf("input field %d: offset mismatch: have %d, want %d", i, field.Offset, offsets[i])
+		}
+	}
+	output := layout.Report(Output, 0)
+	if output == nil || output.Length() != 1 || len(output.Fields) != 2 {
+		t.Fatalf("output report mismatch: have %+v", output)
+	}
+	if leds := output.Fields[0]; leds.Count != 5 || leds.Size != 1 || leds.Usage(4) != NewUsage(0x08, 0x05) {
+		t.Errorf("led field mismatch: have %d x %d bits, last usage %v", leds.Count, leds.Size, leds.Usage(4))
+	}
+	if layout.Report(Feature, 0) != nil {
+		t.Errorf("unexpected feature report")
+	}
+	// Unnumbered output reports still need room for the 0x00 report ID
+	if size := layout.MaxSize(Input); size != 8 {
+		t.Errorf("max input size mismatch: have %d, want 8", size)
+	}
+	if size := layout.MaxSize(Output); size != 2 {
+		t.Errorf("max output size mismatch: have %d, want 2", size)
+	}
+}
+
+// Tests that the buffer size of unnumbered feature reports accounts for the 0x00
+// report ID hidapi expects in front of them.
+func TestLayoutUnnumberedFeature(t *testing.T) {
+	// Vendor collection with a single unnumbered 32 byte feature report
+	desc, err := Parse([]byte{
+		0x06, 0x00, 0xff, 0x09, 0x01, 0xa1, 0x01, 0x15, 0x00, 0x26, 0xff, 0x00,
+		0x75, 0x08, 0x95, 0x20, 0x09, 0x02, 0xb1, 0x02, 0xc0,
+	})
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	layout := desc.Layout()
+	if feature := layout.Report(Feature, 0); feature == nil || feature.Size() != 32 || feature.BufferSize() != 33 {
+		t.Fatalf("feature report mismatch: have %+v", feature)
+	}
+	if size := layout.MaxSize(Feature); size != 33 {
+		t.Errorf("max feature size mismatch: have %d, want 33", size)
+	}
+}
+
+// Tests that numbered report layouts are split per report ID and include the
+// report ID prefix in their transfer size.
+func TestLayoutNumbered(t *testing.T) {
+	desc, err := Parse(numberedReports)
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	layout := desc.Layout()
+	if !layout.Numbered {
+		t.Errorf("composite reported as unnumbered")
+	}
+	tests := []struct {
+		kind   ReportKind
+		id     uint8
+		bits   int
+		size   int
+		fields int
+	}{
+		{Input, 1, 32, 5, 3},
+		{Input, 2, 16, 3, 1},
+		{Feature, 3, 56, 8, 1},
+	}
+	if len(layout.Reports) != len(tests) {
+		t.Fatalf("report count mismatch: have %d, want %d", len(layout.Reports), len(tests))
+	}
+	for i, tt := range tests {
+		report := layout.Reports[i]
+		if report.Kind != tt.kind || report.ID != tt.id {
+			t.Errorf("report %d: identity mismatch: have %v/%d, want %v/%d", i, report.Kind, report.ID, tt.kind, tt.id)
+		}
+		if report.Bits != tt.bits || report.Size() != tt.size || len(report.Fields) != tt.fields {
+			t.Errorf("report %d: size mismatch: have %d bits, %d bytes, %d fields, want %d, %d, %d",
+				i, report.Bits, report.Size(), len(report.Fields), tt.bits, tt.size, tt.fields)
+		}
+	}
+	axes := layout.Report(Input, 1).Fields[2]
+	if axes.Offset != 8 || axes.Size != 12 || axes.LogicalMinimum != -2047 || axes.LogicalMaximum != 2047 {
+		t.Errorf("axes mismatch: have offset %d, size %d, range [%d, %d]", axes.Offset, axes.Size, axes.LogicalMinimum, axes.LogicalMaximum)
+	}
+	if size := layout.MaxSize(Input); size != 5 {
+		t.Errorf("max input size mismatch: have %d, want 5", size)
+	}
+	if size := layout.MaxSize(Output); size != 0 {
+		t.Errorf("max output size mismatch: have %d, want 0", size)
+	}
+}
@@ -0,0 +1,371 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrReportSize is returned if a raw report buffer is too short for the
+	// layout it's being decoded with.
+	ErrReportSize = errors.New("descriptor: report too short")
+
+	// ErrReportID is returned if a raw report buffer starts with a different
+	// report ID than the layout it's being decoded with.
+	ErrReportID = errors.New("descriptor: report id mismatch")
+
+	// ErrUnknownUsage is returned if a usage is set on a report that has no
+	// field for it.
+	ErrUnknownUsage = errors.New("descriptor: usage not in report")
+
+	// ErrOutOfRange is returned if a value is set that is outside the logical
+	// range of its field.
+	ErrOutOfRange = errors.New("descriptor: value out of logical range")
+
+	// ErrArrayFull is returned if a usage is activated in an array field that
+	// has all its elements already in use.
+	ErrArrayFull = errors.New("descriptor: array field full")
+
+	// ErrReportTooLarge is returned if a report is declared larger than any HID
+	// transport can carry, to avoid huge allocations for bogus descriptors.
+	ErrReportTooLarge = errors.New("descriptor: report too large")
+)
+
+// MaxReportSize is the largest report buffer that can be allocated, matching the
+// kernel's HID_MAX_BUFFER_SIZE.
+const MaxReportSize = 16384
+
+// maxFieldBits is the largest element size that can be decoded into a value.
+// Larger elements are only accessible through the raw report bytes.
+const maxFieldBits = 64
+
+// decodable returns whether the elements of a field can be decoded into values.
+// Zero sized elements carry no data, so they are skipped instead of iterating
+// over their (possibly huge) count.
+func (f *Field) decodable() bool {
+	return f.Size > 0 && f.Size <= maxFieldBits
+}
+
+// Prefixed returns whether the report buffer as exchanged with hidapi starts with
+// a report ID byte. Output and feature reports always do (with 0x00 standing in
+// for unnumbered reports), input reports read from the interrupt endpoint only if
+// they are numbered. Input reports fetched through Device.GetInputReport are a
+// control transfer and always prefixed, see DecodeControl.
+func (r *ReportLayout) Prefixed() bool {
+	return r.Numbered || r.Kind != Input
+}
+
+// BufferSize returns the size of the buffer needed to exchange the report with
+// hidapi, including the report ID byte if the report is prefixed with it (see
+// Prefixed). Unlike Size, it counts the 0x00 placeholder ID that hidapi expects
+// in front of unnumbered output and feature reports.
+func (r *ReportLayout) BufferSize() int {
+	if r.Prefixed() {
+		return r.Length() + 1
+	}
+	return r.Length()
+}
+
+// ControlSize returns the size of the buffer needed to fetch the report through a
+// control transfer (Device.GetInputReport or Device.GetFeatureReport), which is
+// always prefixed by the report ID byte, even for unnumbered reports.
+func (r *ReportLayout) ControlSize() int {
+	return r.Length() + 1
+}
+
+// Value is a single decoded element of a report field.
+type Value struct {
+	Field *Field // Field the element is part of
+	Index int    // Index of the element within the field
+	Usage Usage  // Usage of the element, or the selected usage for arrays (0 if none)
+	Value int64  // Logical value of the element, or the raw selector for arrays
+}
+
+// Report is a single report backed by a raw buffer, providing typed access to
+// its fields.
+type Report struct {
+	Layout *ReportLayout // Layout describing the fields of the report
+
+	buffer []byte // Raw report buffer as exchanged with hidapi
+}
+
+// NewReport creates a zeroed report for the given layout, with the report ID
+// already set if the report is prefixed with one.
+func NewReport(layout *ReportLayout) (*Report, error) {
+	if size := layout.BufferSize(); size > MaxReportSize {
+		return nil, fmt.Errorf("%w: %d bytes, max %d", ErrReportTooLarge, size, MaxReportSize)
+	}
+	report := &Report{
+		Layout: layout,
+		buffer: make([]byte, layout.BufferSize()),
+	}
+	if layout.Prefixed() {
+		report.buffer[0] = layout.ID
+	}
+	return report, nil
+}
+
+// Decode wraps a raw report buffer (e.g. retrieved via Device.ReadTimeout or
+// Device.GetFeatureReport) for typed access. The buffer must start with the
+// report ID if the report is prefixed with one. The buffer is copied.
+//
+// Input reports retrieved via Device.GetInputReport start with the report ID even
+// if unnumbered, decode them with DecodeControl instead.
+func (r *ReportLayout) Decode(b []byte) (*Report, error) {
+	if size := r.BufferSize(); size > MaxReportSize {
+		return nil, fmt.Errorf("%w: %d bytes, max %d", ErrReportTooLarge, size, MaxReportSize)
+	}
+	if len(b) < r.BufferSize() {
+		return nil, fmt.Errorf("%w: have %d bytes, want %d", ErrReportSize, len(b), r.BufferSize())
+	}
+	if r.Numbered && b[0] != r.ID {
+		return nil, fmt.Errorf("%w: have %d, want %d", ErrReportID, b[0], r.ID)
+	}
+	report := &Report{
+		Layout: r,
+		buffer: make([]byte, r.BufferSize()),
+	}
+	copy(report.buffer, b)
+	return report, nil
+}
+
+// DecodeControl wraps a raw report buffer retrieved through a control transfer
+// (Device.GetInputReport or Device.GetFeatureReport) for typed access. Unlike
+// reads from the interrupt endpoint, these always start with the report ID byte,
+// which is stripped from unnumbered input reports to match their layout.
+func (r *ReportLayout) DecodeControl(b []byte) (*Report, error) {
+	if r.Prefixed() {
+		return r.Decode(b)
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%w: missing report id", ErrReportSize)
+	}
+	if b[0] != 0 {
+		return nil, fmt.Errorf("%w: have %d, want 0", ErrReportID, b[0])
+	}
+	return r.Decode(b[1:])
+}
+
+// Decode wraps a raw report buffer for typed access, looking up the layout based
+// on the report kind and the report ID prefix (if the reports are numbered).
+func (l *Layout) Decode(kind ReportKind, b []byte) (*Report, error) {
+	var id uint8
+	if l.Numbered {
+		if len(b) == 0 {
+			return nil, fmt.Errorf("%w: missing report id", ErrReportSize)
+		}
+		id = b[0]
+	}
+	layout := l.Report(kind, id)
+	if layout == nil {
+		return nil, fmt.Errorf("%w: %v report %d not declared", ErrReportID, kind, id)
+	}
+	return layout.Decode(b)
+}
+
+// Bytes returns the raw report buffer, ready to be passed to Device.Write or
+// Device.SendFeatureReport.
+func (r *Report) Bytes() []byte {
+	return r.buffer
+}
+
+// data returns the report data without the report ID prefix.
+func (r *Report) data() []byte {
+	if r.Layout.Prefixed() {
+		return r.buffer[1:]
+	}
+	return r.buffer
+}
+
+// Values decodes all the non-constant elements of the report.
+func (r *Report) Values() []Value {
+	var values []Value
+	for _, field := range r.Layout.Fields {
+		if field.Constant() || !field.decodable() {
+			continue
+		}
+		for i := 0; i < field.Count; i++ {
+			values = append(values, r.value(field, i))
+		}
+	}
+	return values
+}
+
+// value decodes a single element of a field.
+func (r *Report) value(field *Field, index int) Value {
+	raw := extractBits(r.data(), field.Offset+index*field.Size, field.Size)
+
+	value := Value{Field: field, Index: index}
+	if field.LogicalMinimum < 0 {
+		value.Value = signExtend(raw, field.Size)
+	} else {
+		value.Value = int64(raw)
+	}
+	if field.Variable() {
+		value.Usage = field.Usage(index)
+	} else if selector := value.Value - field.LogicalMinimum; selector >= 0 && selector < int64(field.UsageCount()) {
+		// Usage ID 0 is reserved on every page, arrays use it for "no event"
+		if usage := field.Usage(int(selector)); usage.ID() != 0 {
+			value.Usage = usage
+		}
+	}
+	return value
+}
+
+// Get returns the logical value of the first element associated with a usage.
+// For array fields, it returns 1 if the usage is selected in any element and 0
+// otherwise. The boolean result is false if the report has no such usage.
+func (r *Report) Get(usage Usage) (int64, bool) {
+	for _, field := range r.Layout.Fields {
+		if field.Constant() || !field.decodable() {
+			continue
+		}
+		if field.Variable() {
+			if index := field.index(usage); index >= 0 && index < field.Count {
+				return r.value(field, index).Value, true
+			}
+			continue
+		}
+		if field.index(usage) < 0 {
+			continue
+		}
+		for i := 0; i < field.Count; i++ {
+			if r.value(field, i).Usage == usage {
+				return 1, true
+			}
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Set updates the logical value of the first element associated with a usage.
+// For array fields, a non-zero value selects the usage in the first free element
+// (if not yet selected) and a zero value clears all elements selecting it.
+func (r *Report) Set(usage Usage, value int64) error {
+	for _, field := range r.Layout.Fields {
+		if field.Constant() || !field.decodable() {
+			continue
+		}
+		index := field.index(usage)
+		if index < 0 || (field.Variable() && index >= field.Count) {
+			continue
+		}
+		if field.Variable() {
+			return r.SetValue(field, index, value)
+		}
+		return r.setArray(field, index, value != 0)
+	}
+	return fmt.Errorf("%w: %v", ErrUnknownUsage, usage)
+}
+
+// SetValue updates the logical value of a specific element of a field. For array
+// fields the value is the raw usage selector.
+func (r *Report) SetValue(field *Field, index int, value int64) error {
+	if index < 0 || index >= field.Count {
+		return fmt.Errorf("descriptor: element index %d out of bounds [0, %d)", index, field.Count)
+	}
+	if !field.decodable() {
+		return fmt.Errorf("descriptor: field size %d bits not supported", field.Size)
+	}
+	if field.LogicalMinimum <= field.LogicalMaximum && (value < field.LogicalMinimum || value > field.LogicalMaximum) {
+		return fmt.Errorf("%w: %d not in [%d, %d]", ErrOutOfRange, value, field.LogicalMinimum, field.LogicalMaximum)
+	}
+	insertBits(r.data(), field.Offset+index*field.Size, field.Size, uint64(value))
+	return nil
+}
+
+// setArray selects or deselects a usage within an array field.
+func (r *Report) setArray(field *Field, usageIndex int, active bool) error {
+	selector := field.LogicalMinimum + int64(usageIndex)
+	if !active {
+		for i := 0; i < field.Count; i++ {
+			if r.value(field, i).Value == selector {
+				insertBits(r.data(), field.Offset+i*field.Size, field.Size, uint64(nullSelector(field)))
+			}
+		}
+		return nil
+	}
+	free := -1
+	for i := 0; i < field.Count; i++ {
+		value := r.value(field, i)
+		if value.Value == selector {
+			return nil
+		}
+		if free < 0 && value.Usage == 0 {
+			free = i
+		}
+	}
+	if free < 0 {
+		return fmt.Errorf("%w: %d elements", ErrArrayFull, field.Count)
+	}
+	insertBits(r.data(), field.Offset+free*field.Size, field.Size, uint64(selector))
+	return nil
+}
+
+// nullSelector returns the array selector value meaning "no usage selected". It
+// is zero if that's outside the logical range, or the logical minimum otherwise,
+// which conventionally maps to the reserved usage ID 0.
+func nullSelector(field *Field) int64 {
+	if field.LogicalMinimum > 0 {
+		return 0
+	}
+	return field.LogicalMinimum
+}
+
+// index returns the position of a usage within the field's usage list, or -1 if
+// the field does not declare it.
+func (f *Field) index(usage Usage) int {
+	var base int
+	for _, r := range f.Usages {
+		if usage >= r.Min && usage <= r.Max {
+			return base + int(usage-r.Min)
+		}
+		base += r.Count()
+	}
+	return -1
+}
+
+// extractBits reads a little endian, LSB first bit field of up to 64 bits.
+func extractBits(data []byte, offset int, size int) uint64 {
+	var value uint64
+	for i := 0; i < size; i++ {
+		bit := offset + i
+		if bit/8 >= len(data) {
+			break
+		}
+		if data[bit/8]&(1<<(bit%8)) != 0 {
+			value |= 1 << i
+		}
+	}
+	return value
+}
+
+// insertBits writes a little endian, LSB first bit field of up to 64 bits.
+func insertBits(data []byte, offset int, size int, value uint64) {
+	for i := 0; i < size; i++ {
+		bit := offset + i
+		if bit/8 >= len(data) {
+			break
+		}
+		if value&(1<<i) != 0 {
+			data[bit/8] |= 1 << (bit % 8)
+		} else {
+			data[bit/8] &^= 1 << (bit % 8)
+		}
+	}
+}
+
+// signExtend interprets the low size bits of value as a two's complement number.
+func signExtend(value uint64, size int) int64 {
+	if size <= 0 || size >= 64 {
+		return int64(value)
+	}
+	shift := 64 - size
+	return int64(value<<shift) >> shift
+}
@@ -0,0 +1,241 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Tests that signed, bit packed fields crossing byte boundaries are decoded and
+// encoded correctly.
+func TestReportPackedSigned(t *testing.T) {
+	desc, err := Parse(numberedReports)
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	layout := desc.Layout()
+
+	// Buttons 1 and 3 pressed, X = -2 (0xffe), Y = 1025 (0x401)
+	raw := []byte{0x01, 0x05, 0xfe, 0x1f, 0x40}
+
+	report, err := layout.Decode(Input, raw)
+	if err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	tests := []struct {
+		usage Usage
+		value int64
+	}{
+		{NewUsage(0x09, 1), 1},
+		{NewUsage(0x09, 2), 0},
+		{NewUsage(0x09, 3), 1},
+		{NewUsage(0x01, 0x30), -2},
+		{NewUsage(0x01, 0x31), 1025},
+	}
+	for _, tt := range tests {
+		if have, ok := report.Get(tt.usage); !ok || have != tt.value {
+			t.Errorf("usage %v: value mismatch: have %d (%v), want %d", tt.usage, have, ok, tt.value)
+		}
+	}
+	if values := report.Values(); len(values) != 7 {
+		t.Errorf("value count mismatch: have %d, want 7", len(values))
+	}
+	// Rebuild the same report from scratch and ensure it packs identically
+	packed, err := NewReport(layout.Report(Input, 1))
+	if err != nil {
+		t.Fatalf("failed to create report: %v", err)
+	}
+	for _, tt := range tests {
+		if err := packed.Set(tt.usage, tt.value); err != nil {
+			t.Fatalf("usage %v: failed to set value: %v", tt.usage, err)
+		}
+	}
+	if !bytes.Equal(packed.Bytes(), raw) {
+		t.Errorf("packed report mismatch: have %x, want %x", packed.Bytes(), raw)
+	}
+	// Ensure invalid values and usages are rejected
+	if err := packed.Set(NewUsage(0x01, 0x30), 2048); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("out of range error mismatch: have %v, want %v", err, ErrOutOfRange)
+	}
+	if err := packed.Set(NewUsage(0x01, 0x38), 1); !errors.Is(err, ErrUnknownUsage) {
+		t.Errorf("unknown usage error mismatch: have %v, want %v", err, ErrUnknownUsage)
+	}
+	if _, err := layout.Decode(Input, raw[:4]); !errors.Is(err, ErrReportSize) {
+		t.Errorf("short report error mismatch: have %v, want %v", err, ErrReportSize)
+	}
+	if _, err := layout.Decode(Input, []byte{0x03, 0, 0, 0, 0}); !errors.Is(err, ErrReportID) {
+		t.Errorf("unknown report error mismatch: have %v, want %v", err, ErrReportID)
+	}
+}
+
+// Tests that array fields are decoded into selected usages, and that selecting
+// and deselecting usages fills and clears array elements.
+func TestReportArray(t *testing.T) {
+	desc, err := Parse(bootKeyboard)
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	layout := desc.Layout()
+
+	// Left shift, 'a' (0x04) and 'b' (0x05) pressed
+	report, err := layout.Decode(Input, []byte{0x02, 0x00, 0x04, 0x05, 0x00, 0x00, 0x00, 0x00})
+	if err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if have, _ := report.Get(NewUsage(0x07, 0xe1)); have != 1 {
+		t.Errorf("left shift not pressed")
+	}
+	if have, _ := report.Get(NewUsage(0x07, 0x04)); have != 1 {
+		t.Errorf("key 'a' not pressed")
+	}
+	if have, ok := report.Get(NewUsage(0x07, 0x06)); !ok || have != 0 {
+		t.Errorf("key 'c' state mismatch: have %d (%v), want 0 (true)", have, ok)
+	}
+	var keys []Usage
+	for _, value := range report.Values() {
+		if !value.Field.Variable() && value.Usage != 0 {
+			keys = append(keys, value.Usage)
+		}
+	}
+	if len(keys) != 2 || keys[0] != NewUsage(0x07, 0x04) || keys[1] != NewUsage(0x07, 0x05) {
+		t.Errorf("selected keys mismatch: have %v", keys)
+	}
+	// Release 'a', press 'c' and ensure it takes the first free slot
+	if err := report.Set(NewUsage(0x07, 0x04), 0); err != nil {
+		t.Fatalf("failed to release key: %v", err)
+	}
+	if err := report.Set(NewUsage(0x07, 0x06), 1); err != nil {
+		t.Fatalf("failed to press key: %v", err)
+	}
+	if want := []byte{0x02, 0x00, 0x06, 0x05, 0x00, 0x00, 0x00, 0x00}; !bytes.Equal(report.Bytes(), want) {
+		t.Errorf("packed report mismatch: have %x, want %x", report.Bytes(), want)
+	}
+	// Fill up the array and ensure overflows are rejected
+	for key := uint16(0x07); key < 0x0b; key++ {
+		if err := report.Set(NewUsage(0x07, key), 1); err != nil {
+			t.Fatalf("failed to press key %#x: %v", key, err)
+		}
+	}
+	if err := report.Set(NewUsage(0x07, 0x0b), 1); !errors.Is(err, ErrArrayFull) {
+		t.Errorf("overflow error mismatch: have %v, want %v", err, ErrArrayFull)
+	}
+}
+
+// Tests that output and feature reports are prefixed with a report ID byte even
+// if the descriptor uses no numbered reports, as hidapi expects.
+func TestReportOutputPrefix(t *testing.T) {
+	desc, err := Parse(bootKeyboard)
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	leds, err := NewReport(desc.Layout().Report(Output, 0))
+	if err != nil {
+		t.Fatalf("failed to create report: %v", err)
+	}
+	if err := leds.Set(NewUsage(0x08, 0x02), 1); err != nil { // Caps Lock
+		t.Fatalf("failed to set led: %v", err)
+	}
+	if want := []byte{0x00, 0x02}; !bytes.Equal(leds.Bytes(), want) {
+		t.Errorf("packed report mismatch: have %x, want %x", leds.Bytes(), want)
+	}
+}
+
+// Tests that reports declared larger than any transport can carry are rejected
+// instead of allocating huge buffers for them.
+func TestReportTooLarge(t *testing.T) {
+	// Vendor input report of 32 bit elements, 0x7fffffff of them, twice
+	raw := []byte{
+		0x06, 0x00, 0xff, 0x09, 0x01, 0xa1, 0x01, 0x75, 0x20, 0x97, 0xff, 0xff, 0xff, 0x7f,
+		0x09, 0x02, 0x81, 0x02, 0x09, 0x03, 0x81, 0x02, 0xc0,
+	}
+	desc, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	layout := desc.Layout().Report(Input, 0)
+	if layout == nil {
+		t.Fatalf("input report missing from layout")
+	}
+	if _, err := NewReport(layout); !errors.Is(err, ErrReportTooLarge) {
+		t.Errorf("create error mismatch: have %v, want %v", err, ErrReportTooLarge)
+	}
+	if _, err := layout.Decode(make([]byte, 64)); !errors.Is(err, ErrReportTooLarge) {
+		t.Errorf("decode error mismatch: have %v, want %v", err, ErrReportTooLarge)
+	}
+}
+
+// Tests that fields with bogus element counts, which take up no space in their
+// report, are bounded instead of being iterated over element by element.
+func TestReportHugeCount(t *testing.T) {
+	// Vendor input report of a byte, followed by 0x7fffffff zero sized elements
+	raw := []byte{
+		0x06, 0x00, 0xff, 0x09, 0x01, 0xa1, 0x01, 0x15, 0x00, 0x26, 0xff, 0x00, 0x75, 0x08, 0x95, 0x01,
+		0x09, 0x02, 0x81, 0x02, 0x75, 0x00, 0x97, 0xff, 0xff, 0xff, 0x7f, 0x09, 0x03, 0x81, 0x02, 0xc0,
+	}
+	desc, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	layout := desc.Layout().Report(Input, 0)
+	if layout == nil {
+		t.Fatalf("input report missing from layout")
+	}
+	if field := layout.Fields[1]; field.Count != maxFieldCount {
+		t.Errorf("field count mismatch: have %d, want %d", field.Count, maxFieldCount)
+	}
+	report, err := layout.Decode([]byte{0x2a})
+	if err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if values := report.Values(); len(values) != 1 || values[0].Value != 0x2a {
+		t.Errorf("values mismatch: have %v, want single 0x2a", values)
+	}
+	if _, ok := report.Get(NewUsage(0xff00, 0x03)); ok {
+		t.Errorf("zero sized usage reported as present")
+	}
+	if err := report.Set(NewUsage(0xff00, 0x03), 1); !errors.Is(err, ErrUnknownUsage) {
+		t.Errorf("zero sized set error mismatch: have %v, want %v", err, ErrUnknownUsage)
+	}
+}
+
+// Tests that input reports fetched through control transfers, which always start
+// with the report ID, are decoded correctly even if the report is unnumbered.
+func TestReportDecodeControl(t *testing.T) {
+	desc, err := Parse(bootKeyboard)
+	if err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	layout := desc.Layout().Report(Input, 0)
+	if size := layout.ControlSize(); size != 9 {
+		t.Errorf("control size mismatch: have %d, want 9", size)
+	}
+	// Left Shift held with the A key pressed, prefixed with the 0x00 report ID
+	raw := []byte{0x00, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	report, err := layout.DecodeControl(raw)
+	if err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if !bytes.Equal(report.Bytes(), raw[1:]) {
+		t.Errorf("report bytes mismatch: have %x, want %x", report.Bytes(), raw[1:])
+	}
+	if value, ok := report.Get(NewUsage(0x07, 0xe1)); !ok || value != 1 {
+		t.Errorf("left shift mismatch: have %d (%v), want 1", value, ok)
+	}
+	if value, ok := report.Get(NewUsage(0x07, 0x04)); !ok || value != 1 {
+		t.Errorf("key a mismatch: have %d (%v), want 1", value, ok)
+	}
+	if _, err := layout.DecodeControl([]byte{0x01, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00}); !errors.Is(err, ErrReportID) {
+		t.Errorf("report id error mismatch: have %v, want %v", err, ErrReportID)
+	}
+	// Output and feature reports are prefixed either way, decoding is the same
+	leds := desc.Layout().Report(Output, 0)
+	if report, err := leds.DecodeControl([]byte{0x00, 0x02}); err != nil || !bytes.Equal(report.Bytes(), []byte{0x00, 0x02}) {
+		t.Errorf("output decode mismatch: have %v, %v", report, err)
+	}
+}
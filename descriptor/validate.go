@@ -0,0 +1,438 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalid is returned by Diagnostics.Err if a descriptor has errors.
+var ErrInvalid = errors.New("descriptor: invalid descriptor")
+
+// Severity is the importance of a validation diagnostic.
+type Severity uint8
+
+const (
+	// SeverityWarning marks descriptors that are technically valid, but likely
+	// contain a mistake, or are handled differently by different hosts.
+	SeverityWarning Severity = iota
+
+	// SeverityError marks descriptors violating the HID spec, which some hosts
+	// (most notably Windows) will reject.
+	SeverityError
+)
+
+// String implements fmt.Stringer.
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a single problem found in a report descriptor.
+type Diagnostic struct {
+	Offset   int      // Byte offset of the offending item within the descriptor
+	Severity Severity // Whether the problem is a spec violation or just suspicious
+	Message  string   // Human readable description of the problem
+}
+
+// String implements fmt.Stringer.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("offset %d: %v: %s", d.Offset, d.Severity, d.Message)
+}
+
+// Diagnostics is a list of problems found in a report descriptor, ordered by
+// their offset.
+type Diagnostics []Diagnostic
+
+// Errors returns only the diagnostics with error severity.
+func (ds Diagnostics) Errors() Diagnostics {
+	var errs Diagnostics
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+// Err returns an error wrapping ErrInvalid and listing all the diagnostics with
+// error severity, or nil if there are none. It's meant to be used in tests:
+//
+//	if err := descriptor.Validate(desc).Err(); err != nil {
+//		t.Fatal(err)
+//	}
+func (ds Diagnostics) Err() error {
+	errs := ds.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for i, d := range errs {
+		msgs[i] = fmt.Sprintf("offset %d: %s", d.Offset, d.Message)
+	}
+	return fmt.Errorf("%w: %s", ErrInvalid, strings.Join(msgs, "; "))
+}
+
+// Validate checks a raw report descriptor for spec violations and common firmware
+// mistakes. Unlike Parse, it does not stop at the first problem, but tries to go
+// through the whole descriptor and report everything it finds.
+func Validate(b []byte) Diagnostics {
+	v := &validator{
+		global:     validatorGlobal{declared: make(map[Tag]bool)},
+		usageMin:   -1,
+		localSeen:  -1,
+		delimiter:  -1,
+		numbered:   -1,
+		unnumbered: -1,
+		reports:    make(map[reportKey]*reportBits),
+	}
+
+	items, err := ParseItems(b)
+	for _, item := range items {
+		v.check(item)
+	}
+	if err != nil {
+		offset := len(b)
+		if n := len(items); n > 0 {
+			offset = items[n-1].Offset + len(items[n-1].Raw)
+		}
+		v.errorf(offset, "truncated item")
+	}
+	v.finish(len(b))
+
+	sort.SliceStable(v.diags, func(i, j int) bool { return v.diags[i].Offset < v.diags[j].Offset })
+	return v.diags
+}
+
+// validatorGlobal is the global state tracked during validation, along with
+// which items were actually declared.
+type validatorGlobal struct {
+	Global
+	declared map[Tag]bool
+}
+
+// clone creates an independent copy of the global state for pushing.
+func (g validatorGlobal) clone() validatorGlobal {
+	declared := make(map[Tag]bool, len(g.declared))
+	for tag := range g.declared {
+		declared[tag] = true
+	}
+	g.declared = declared
+	return g
+}
+
+// reportKey identifies a single report.
+type reportKey struct {
+	kind ReportKind
+	id   uint8
+}
+
+// reportBits tracks the size of a single report during validation.
+type reportBits struct {
+	bits   int // Total number of bits in the report
+	offset int // Offset of the last main item contributing to the report
+}
+
+// validator is the state machine checking the items of a report descriptor.
+type validator struct {
+	diags Diagnostics
+
+	global validatorGlobal   // Current global state
+	stack  []validatorGlobal // Pushed global states
+
+	usages    int    // Number of usages declared since the last main item
+	usageMin  int    // Offset of a Usage Minimum waiting for its maximum, or -1
+	minValue  uint32 // Value of the Usage Minimum waiting for its maximum
+	localSeen int    // Offset of the first local item since the last main item, or -1
+	delimiter int    // Offset of an open delimiter set, or -1
+
+	collections []int // Offsets of the currently open collections
+
+	numbered   int  // Offset of the first numbered main item, or -1
+	unnumbered int  // Offset of the first unnumbered main item, or -1
+	mixed      bool // Whether mixing was already reported
+
+	reports map[reportKey]*reportBits
+	order   []reportKey
+}
+
+// errorf records a diagnostic with error severity.
+func (v *validator) errorf(offset int, format string, args ...interface{}) {
+	v.diags = append(v.diags, Diagnostic{Offset: offset, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+}
+
+// warnf records a diagnostic with warning severity.
+func (v *validator) warnf(offset int, format string, args ...interface{}) {
+	v.diags = append(v.diags, Diagnostic{Offset: offset, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+// check validates a single item and updates the validator state.
+func (v *validator) check(item Item) {
+	if item.Long() {
+		v.warnf(item.Offset, "long item %#02x, no long items are defined", item.LongTag)
+		return
+	}
+	if !item.Tag.Known() {
+		v.errorf(item.Offset, "reserved item tag %#02x", uint8(item.Tag))
+		return
+	}
+	switch item.Type() {
+	case TypeMain:
+		v.checkMain(item)
+	case TypeGlobal:
+		v.checkGlobal(item)
+	case TypeLocal:
+		v.checkLocal(item)
+	}
+}
+
+// checkMain validates a main item, resetting the local state afterwards.
+func (v *validator) checkMain(item Item) {
+	if v.usageMin >= 0 {
+		v.errorf(v.usageMin, "usage minimum without usage maximum")
+	}
+	if v.delimiter >= 0 {
+		v.errorf(v.delimiter, "delimiter set not closed before main item")
+	}
+	switch item.Tag {
+	case TagCollection:
+		kind := CollectionType(item.Unsigned())
+		if len(v.collections) == 0 && kind != CollectionApplication {
+			v.errorf(item.Offset, "top level collection is %v, not Application", kind)
+		}
+		if kind > CollectionUsageModifier && kind < 0x80 {
+			v.errorf(item.Offset, "reserved collection type %#02x", uint8(kind))
+		}
+		v.collections = append(v.collections, item.Offset)
+
+	case TagEndCollection:
+		if len(v.collections) == 0 {
+			v.errorf(item.Offset, "end collection without open collection")
+			break
+		}
+		if v.localSeen >= 0 {
+			v.warnf(v.localSeen, "local items before end collection are discarded")
+		}
+		v.collections = v.collections[:len(v.collections)-1]
+
+	case TagInput, TagOutput, TagFeature:
+		v.checkReport(item)
+	}
+	v.usages, v.usageMin, v.delimiter, v.localSeen = 0, -1, -1, -1
+}
+
+// checkReport validates an Input, Output or Feature main item.
+func (v *validator) checkReport(item Item) {
+	var (
+		global   = v.global
+		flags    = Flags(item.Unsigned())
+		kind     = reportKind(item.Tag)
+		constant = flags&FlagConstant != 0
+	)
+	if len(v.collections) == 0 {
+		v.errorf(item.Offset, "%v item outside of any collection", item.Tag)
+	}
+	if !global.declared[TagReportSize] {
+		v.errorf(item.Offset, "%v item without report size", item.Tag)
+	} else if global.ReportSize == 0 {
+		v.warnf(item.Offset, "%v item with zero report size", item.Tag)
+	}
+	if !global.declared[TagReportCount] {
+		v.errorf(item.Offset, "%v item without report count", item.Tag)
+	} else if global.ReportCount == 0 {
+		v.warnf(item.Offset, "%v item with zero report count", item.Tag)
+	}
+	// Track numbered and unnumbered reports, they must not be mixed
+	if global.ReportID == 0 {
+		if v.unnumbered < 0 {
+			v.unnumbered = item.Offset
+		}
+	} else if v.numbered < 0 {
+		v.numbered = item.Offset
+	}
+	if !v.mixed && v.numbered >= 0 && v.unnumbered >= 0 {
+		v.mixed = true
+		v.errorf(item.Offset, "mixed numbered and unnumbered reports")
+	}
+	key := reportKey{kind, global.ReportID}
+	report, ok := v.reports[key]
+	if !ok {
+		report = new(reportBits)
+		v.reports[key] = report
+		v.order = append(v.order, key)
+	}
+	report.bits = addBits(report.bits, global.ReportSize, global.ReportCount)
+	report.offset = item.Offset
+
+	// Constant items are padding, the rest only applies to data items
+	if constant {
+		return
+	}
+	if !global.declared[TagLogicalMinimum] || !global.declared[TagLogicalMaximum] {
+		v.errorf(item.Offset, "%v item without logical range", item.Tag)
+	} else if global.LogicalMinimum > global.LogicalMaximum {
+		v.errorf(item.Offset, "logical minimum %d above logical maximum %d", global.LogicalMinimum, global.LogicalMaximum)
+	} else if size := global.ReportSize; size > 0 && size < 32 && !fits(global.LogicalMinimum, global.LogicalMaximum, size) {
+		v.errorf(item.Offset, "logical range [%d, %d] does not fit into %d bits", global.LogicalMinimum, global.LogicalMaximum, size)
+	}
+	if (global.PhysicalMinimum != 0 || global.PhysicalMaximum != 0) && global.PhysicalMinimum > global.PhysicalMaximum {
+		v.errorf(item.Offset, "physical minimum %d above physical maximum %d", global.PhysicalMinimum, global.PhysicalMaximum)
+	}
+	if !global.declared[TagUsagePage] {
+		v.warnf(item.Offset, "%v item without usage page", item.Tag)
+	}
+	switch {
+	case v.usages == 0:
+		v.warnf(item.Offset, "%v item without usages", item.Tag)
+
+	case flags&FlagVariable != 0:
+		// A single usage for multiple fields is a common idiom for vendor buffers
+		if v.usages > 1 && uint64(v.usages) < uint64(global.ReportCount) {
+			v.warnf(item.Offset, "%d usages for %d variable fields, last usage repeats", v.usages, global.ReportCount)
+		} else if uint64(v.usages) > uint64(global.ReportCount) {
+			v.warnf(item.Offset, "%d usages for %d variable fields, extra usages ignored", v.usages, global.ReportCount)
+		}
+	default:
+		if global.LogicalMinimum <= global.LogicalMaximum {
+			if selectors := global.LogicalMaximum - global.LogicalMinimum + 1; selectors != int64(v.usages) {
+				v.warnf(item.Offset, "%d usages for %d array selectors", v.usages, selectors)
+			}
+		}
+	}
+}
+
+// fits returns whether a logical range can be represented on the given number of
+// bits, as signed if the minimum is negative, unsigned otherwise.
+func fits(min, max int64, bits uint32) bool {
+	if min < 0 {
+		return min >= -(1<<(bits-1)) && max <= 1<<(bits-1)-1
+	}
+	return max <= 1<<bits-1
+}
+
+// checkGlobal validates a global item and updates the global state.
+func (v *validator) checkGlobal(item Item) {
+	v.global.declared[item.Tag] = true
+
+	switch item.Tag {
+	case TagUsagePage:
+		if len(item.Data) == 4 {
+			v.warnf(item.Offset, "usage page encoded on 4 bytes")
+		}
+		v.global.UsagePage = uint16(item.Unsigned())
+	case TagLogicalMinimum:
+		v.global.LogicalMinimum = int64(item.Signed())
+	case TagLogicalMaximum:
+		v.checkMaximum(item, v.global.LogicalMinimum)
+		v.global.LogicalMaximum = maximum(item, v.global.LogicalMinimum)
+	case TagPhysicalMinimum:
+		v.global.PhysicalMinimum = int64(item.Signed())
+	case TagPhysicalMaximum:
+		v.checkMaximum(item, v.global.PhysicalMinimum)
+		v.global.PhysicalMaximum = maximum(item, v.global.PhysicalMinimum)
+	case TagReportSize:
+		v.global.ReportSize = item.Unsigned()
+	case TagReportCount:
+		v.global.ReportCount = item.Unsigned()
+	case TagReportID:
+		if id := item.Unsigned(); id == 0 || id > 0xff {
+			v.errorf(item.Offset, "invalid report id %d", id)
+		}
+		v.global.ReportID = uint8(item.Unsigned())
+	case TagPush:
+		v.stack = append(v.stack, v.global.clone())
+	case TagPop:
+		if len(v.stack) == 0 {
+			v.errorf(item.Offset, "pop without push")
+			break
+		}
+		v.global = v.stack[len(v.stack)-1]
+		v.stack = v.stack[:len(v.stack)-1]
+	}
+}
+
+// checkMaximum flags logical and physical maximums which are only positive when
+// read as unsigned. The spec defines them as signed, so hosts following it to the
+// letter (e.g. Windows) sign extend 0xff on a single byte to -1 and end up with a
+// range below its non-negative minimum.
+func (v *validator) checkMaximum(item Item, minimum int64) {
+	if minimum >= 0 && item.Signed() < 0 {
+		v.errorf(item.Offset, "%v %#x sign extends to %d, below minimum %d", item.Tag, item.Unsigned(), item.Signed(), minimum)
+	}
+}
+
+// checkLocal validates a local item and updates the local state.
+func (v *validator) checkLocal(item Item) {
+	if v.localSeen < 0 {
+		v.localSeen = item.Offset
+	}
+	switch item.Tag {
+	case TagUsage:
+		v.usages++
+
+	case TagUsageMinimum:
+		if v.usageMin >= 0 {
+			v.errorf(v.usageMin, "usage minimum without usage maximum")
+		}
+		v.usageMin, v.minValue = item.Offset, item.Unsigned()
+		v.usages++ // Provisionally a single usage, extended when the maximum is reached
+
+	case TagUsageMaximum:
+		if v.usageMin < 0 {
+			v.errorf(item.Offset, "usage maximum without usage minimum")
+			break
+		}
+		v.usageMin = -1
+
+		if min, max := v.minValue, item.Unsigned(); max < min {
+			v.errorf(item.Offset, "usage minimum %#x above usage maximum %#x", min, max)
+		} else {
+			v.usages += int(max - min)
+		}
+
+	case TagDelimiter:
+		switch item.Unsigned() {
+		case 1:
+			if v.delimiter >= 0 {
+				v.errorf(item.Offset, "nested delimiter set")
+			}
+			v.delimiter = item.Offset
+		case 0:
+			if v.delimiter < 0 {
+				v.errorf(item.Offset, "delimiter close without open")
+			}
+			v.delimiter = -1
+		default:
+			v.errorf(item.Offset, "invalid delimiter value %d", item.Unsigned())
+		}
+	}
+}
+
+// finish reports the problems only detectable at the end of the descriptor.
+func (v *validator) finish(end int) {
+	for _, offset := range v.collections {
+		v.errorf(offset, "collection not closed")
+	}
+	if len(v.stack) > 0 {
+		v.warnf(end, "%d pushed global states never popped", len(v.stack))
+	}
+	if v.localSeen >= 0 {
+		v.warnf(v.localSeen, "local items at the end of the descriptor are discarded")
+	}
+	for _, key := range v.order {
+		report := v.reports[key]
+		if report.bits > MaxReportSize*8 {
+			v.errorf(report.offset, "%v report %d is over %d bytes long", key.kind, key.id, MaxReportSize)
+		} else if report.bits%8 != 0 {
+			v.errorf(report.offset, "%v report %d is %d bits long, not byte aligned", key.kind, key.id, report.bits)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package descriptor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Tests that well formed descriptors pass validation without any diagnostics.
+func TestValidateClean(t *testing.T) {
+	for name, desc := range map[string][]byte{"mouse": bootMouse, "keyboard": bootKeyboard, "numbered": numberedReports} {
+		if diags := Validate(desc); len(diags) != 0 {
+			t.Errorf("%s: unexpected diagnostics: %v", name, diags)
+		}
+		if err := Validate(desc).Err(); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+}
+
+// Tests that common descriptor mistakes are detected and reported at the right
+// offset with the right severity.
+func TestValidateDiagnostics(t *testing.T) {
+	// header opens a vendor application collection with a well formed global state
+	header := []byte{0x06, 0x00, 0xff, 0x09, 0x01, 0xa1, 0x01, 0x15, 0x00, 0x25, 0x01}
+
+	tests := []struct {
+		name     string
+		desc     []byte
+		offset   int
+		severity Severity
+		message  string
+	}{
+		{"unclosed collection", append(header[:7:7], 0x75, 0x08, 0x95, 0x01), 5, SeverityError, "collection not closed"},
+		{"stray end collection", append(header[:7:7], 0xc0, 0xc0), 8, SeverityError, "end collection without open collection"},
+		{"missing size", join(header, []byte{0x95, 0x01, 0x09, 0x02, 0x81, 0x02, 0xc0}), 15, SeverityError, "without report size"},
+		{"missing count", join(header, []byte{0x75, 0x08, 0x09, 0x02, 0x81, 0x02, 0xc0}), 15, SeverityError, "without report count"},
+		{"unaligned", join(header, []byte{0x75, 0x01, 0x95, 0x03, 0x19, 0x01, 0x29, 0x03, 0x81, 0x02, 0xc0}), 19, SeverityError, "not byte aligned"},
+		{"mixed ids", join(header, []byte{0x75, 0x08, 0x95, 0x01, 0x09, 0x02, 0x81, 0x02, 0x85, 0x01, 0x09, 0x03, 0x81, 0x02, 0xc0}), 23, SeverityError, "mixed numbered and unnumbered"},
+		{"inverted range", join(header, []byte{0x15, 0x05, 0x75, 0x08, 0x95, 0x01, 0x09, 0x02, 0x81, 0x02, 0xc0}), 19, SeverityError, "above logical maximum"},
+		{"range overflow", join(header, []byte{0x26, 0xff, 0x01, 0x75, 0x08, 0x95, 0x01, 0x09, 0x02, 0x81, 0x02, 0xc0}), 20, SeverityError, "does not fit into 8 bits"},
+		{"huge report", join(header, []byte{0x77, 0xff, 0xff, 0xff, 0xff, 0x97, 0xff, 0xff, 0xff, 0xff, 0x09, 0x02, 0x81, 0x02, 0x81, 0x02, 0xc0}), 25, SeverityError, "Input report 0 is over 16384 bytes long"},
+		{"unsigned maximum", join(header, []byte{0x25, 0xff, 0x75, 0x08, 0x95, 0x01, 0x09, 0x02, 0x81, 0x02, 0xc0}), 11, SeverityError, "Logical Maximum 0xff sign extends to -1, below minimum 0"},
+		{"few usages", join(header, []byte{0x75, 0x08, 0x95, 0x03, 0x09, 0x02, 0x09, 0x03, 0x81, 0x02, 0xc0}), 19, SeverityWarning, "2 usages for 3 variable fields"},
+		{"array usages", join(header, []byte{0x25, 0x04, 0x75, 0x08, 0x95, 0x01, 0x19, 0x01, 0x29, 0x03, 0x81, 0x00, 0xc0}), 21, SeverityWarning, "3 usages for 5 array selectors"},
+		{"reserved tag", join(header, []byte{0x75, 0x08, 0x95, 0x01, 0x09, 0x02, 0xd1, 0x00, 0x81, 0x02, 0xc0}), 17, SeverityError, "reserved item tag 0xd0"},
+		{"reserved 0xfc tag", join(header, []byte{0x75, 0x08, 0x95, 0x01, 0x09, 0x02, 0xff, 0x00, 0x00, 0x00, 0x00, 0x81, 0x02, 0xc0}), 17, SeverityError, "reserved item tag 0xfc"},
+		{"report id 0", join(header, []byte{0x85, 0x00, 0x75, 0x08, 0x95, 0x01, 0x09, 0x02, 0x81, 0x02, 0xc0}), 11, SeverityError, "invalid report id 0"},
+		{"physical top level", []byte{0x05, 0x01, 0x09, 0x01, 0xa1, 0x00, 0xc0}, 4, SeverityError, "not Application"},
+		{"outside collection", []byte{0x05, 0x01, 0x09, 0x30, 0x15, 0x00, 0x25, 0x01, 0x75, 0x08, 0x95, 0x01, 0x81, 0x02}, 12, SeverityError, "outside of any collection"},
+		{"pending minimum", join(header, []byte{0x75, 0x08, 0x95, 0x01, 0x19, 0x01, 0x81, 0x02, 0xc0}), 15, SeverityError, "usage minimum without usage maximum"},
+		{"pop underflow", join(header, []byte{0xb4, 0xc0}), 11, SeverityError, "pop without push"},
+		{"truncated", join(header, []byte{0x75}), 11, SeverityError, "truncated item"},
+	}
+	for _, tt := range tests {
+		var found bool
+		for _, diag := range Validate(tt.desc) {
+			if diag.Offset == tt.offset && diag.Severity == tt.severity && strings.Contains(diag.Message, tt.message) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("%s: missing %v %q at offset %d, have %v", tt.name, tt.severity, tt.message, tt.offset, Validate(tt.desc))
+		}
+	}
+}
+
+// Tests that only error diagnostics are turned into an error.
+func TestValidateErr(t *testing.T) {
+	// Two usages for a single variable field only warrants a warning
+	warn := []byte{0x06, 0x00, 0xff, 0x09, 0x01, 0xa1, 0x01, 0x15, 0x00, 0x25, 0x01, 0x75, 0x08, 0x95, 0x01, 0x09, 0x02, 0x09, 0x03, 0x81, 0x02, 0xc0}
+
+	diags := Validate(warn)
+	if len(diags) != 1 || diags[0].Severity != SeverityWarning {
+		t.Fatalf("diagnostics mismatch: have %v, want a single warning", diags)
+	}
+	if err := diags.Err(); err != nil {
+		t.Errorf("warning turned into error: %v", err)
+	}
+	if err := Validate(warn[:len(warn)-1]).Err(); !errors.Is(err, ErrInvalid) {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrInvalid)
+	}
+}
+
+// join concatenates byte slices into a freshly allocated one.
+func join(parts ...[]byte) []byte {
+	var b []byte
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+	return b
+}
@@ -0,0 +1,442 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// readPollInterval is the maximum time a read blocks inside the platform library
+// before checking whether the device was closed, its context cancelled or its
+// deadline moved in the mean time.
+const readPollInterval = 50 * time.Millisecond
+
+// handle is the platform specific part of an open device, wrapping the native
+// device handle. The device ensures that no method is ever called concurrently
+// with or after close.
+type handle interface {
+	write(b []byte) (int, error)
+	readTimeout(b []byte, timeout int) (int, error)
+	sendFeatureReport(b []byte) (int, error)
+	getFeatureReport(b []byte) (int, error)
+	getInputReport(b []byte) (int, error)
+	getReportDescriptor() ([]byte, error)
+	info() (DeviceInfo, error)
+	manufacturer() (string, error)
+	product() (string, error)
+	serialNumber() (string, error)
+	indexedString(index int) (string, error)
+	close() error
+}
+
+// device is a live HID device, managing the lifetime of its native handle.
+//
+// Every operation acquires a reference to the handle for the duration of the
+// native call. Close marks the device closed, so no new references are handed
+// out, then waits for the in-flight calls to drain before releasing the handle.
+// Since reads are executed in short slices, blocked readers notice the closure
+// within readPollInterval and return ErrDeviceClosed.
+type device struct {
+	DeviceInfo // Embed the infos for easier access
+
+	handle handle     // Platform specific handle, nil after closing
+	lock   sync.Mutex // Lock protecting the fields below
+	drain  *sync.Cond // Signalled when the last in-flight call finishes
+	refs   int        // Number of in-flight calls using the handle
+	closed bool       // Whether the device was closed (maybe still draining)
+
+	readDeadline  time.Time // Deadline for Read and ReadContext calls, zero if none
+	writeDeadline time.Time // Deadline for Write and WriteContext calls, zero if none
+}
+
+// newDevice wraps a platform specific handle into a device.
+func newDevice(info DeviceInfo, handle handle) *device {
+	dev := &device{
+		DeviceInfo: info,
+		handle:     handle,
+	}
+	dev.drain = sync.NewCond(&dev.lock)
+	return dev
+}
+
+// acquire retrieves the native handle for a single call, preventing it from being
+// released until the call finishes. Every successful acquire must be followed by
+// a release.
+func (dev *device) acquire() (handle, error) {
+	dev.lock.Lock()
+	defer dev.lock.Unlock()
+
+	if dev.closed {
+		return nil, ErrDeviceClosed
+	}
+	dev.refs++
+	return dev.handle, nil
+}
+
+// release returns a previously acquired handle, waking up a pending Close if this
+// was the last in-flight call.
+func (dev *device) release() {
+	dev.lock.Lock()
+	defer dev.lock.Unlock()
+
+	if dev.refs--; dev.refs == 0 && dev.closed {
+		dev.drain.Broadcast()
+	}
+}
+
+// failure converts an error returned by the native handle into the one reported
+// to the user, which is ErrDeviceClosed if the device was closed meanwhile.
+func (dev *device) failure(err error) error {
+	if err == nil {
+		return nil
+	}
+	dev.lock.Lock()
+	defer dev.lock.Unlock()
+
+	if dev.closed {
+		return ErrDeviceClosed
+	}
+	return err
+}
+
+// Close releases the HID device handle. It waits for all in-flight operations to
+// finish, while blocked reads are interrupted and return ErrDeviceClosed.
+func (dev *device) Close() error {
+	dev.lock.Lock()
+	if dev.closed {
+		dev.lock.Unlock()
+		return nil
+	}
+	dev.closed = true
+	for dev.refs > 0 {
+		dev.drain.Wait()
+	}
+	handle := dev.handle
+	dev.handle = nil
+	dev.lock.Unlock()
+
+	return handle.close()
+}
+
+// Write sends an output report to a HID device, honoring the write deadline.
+//
+// Write will send the data on the first OUT endpoint, if one exists. If it does
+// not, it will send the data through the Control Endpoint (Endpoint 0).
+func (dev *device) Write(b []byte) (int, error) {
+	return dev.WriteContext(context.Background(), b)
+}
+
+// write sends an output report to a HID device, blocking until it's done.
+func (dev *device) write(b []byte) (int, error) {
+	// Abort if nothing to write
+	if len(b) == 0 {
+		return 0, nil
+	}
+	handle, err := dev.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer dev.release()
+
+	written, err := handle.write(b)
+	return written, dev.failure(err)
+}
+
+// WriteContext sends an output report to a HID device, returning early if the
+// context is cancelled or the write deadline passes.
+//
+// Writes cannot be interrupted inside the platform libraries, so if the write
+// returns early, it is abandoned in the background and may still reach the device.
+func (dev *device) WriteContext(ctx context.Context, b []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	dev.lock.Lock()
+	deadline := dev.writeDeadline
+	dev.lock.Unlock()
+
+	// If there's nothing to wait on, write directly without the extra goroutine
+	if ctx.Done() == nil && deadline.IsZero() {
+		return dev.write(b)
+	}
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(left)
+		defer timer.Stop()
+
+		expired = timer.C
+	}
+	// Write a copy of the data, so the caller may reuse b if we return early
+	type result struct {
+		written int
+		err     error
+	}
+	done := make(chan result, 1)
+	data := append([]byte{}, b...)
+
+	go func() {
+		written, err := dev.write(data)
+		done <- result{written, err}
+	}()
+	select {
+	case res := <-done:
+		return res.written, res.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-expired:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+// Read retrieves an input report from a HID device, blocking and waiting for a
+// response until the read deadline, if any.
+func (dev *device) Read(b []byte) (int, error) {
+	return dev.read(context.Background(), b, -1)
+}
+
+// ReadTimeout retrieves an input report from a HID device with a timeout. If
+// timeout is -1, a blocking read is performed.
+func (dev *device) ReadTimeout(b []byte, timeout int) (int, error) {
+	if timeout < 0 {
+		return dev.read(context.Background(), b, -1)
+	}
+	return dev.read(context.Background(), b, time.Duration(timeout)*time.Millisecond)
+}
+
+// ReadContext retrieves an input report from a HID device, blocking until one is
+// available, the context is cancelled or the read deadline passes.
+func (dev *device) ReadContext(ctx context.Context, b []byte) (int, error) {
+	return dev.read(ctx, b, -1)
+}
+
+// read retrieves an input report from a HID device, reading in short slices to
+// check for closure, cancellation and deadlines in between. A negative timeout
+// means no timeout.
+func (dev *device) read(ctx context.Context, b []byte, timeout time.Duration) (int, error) {
+	// Abort if nothing to read
+	if len(b) == 0 {
+		return 0, nil
+	}
+	var end time.Time
+	if timeout >= 0 {
+		end = time.Now().Add(timeout)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		dev.lock.Lock()
+		deadline := dev.readDeadline
+		dev.lock.Unlock()
+
+		// Find the longest time to block without missing any event
+		slice := readPollInterval
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			if left < slice {
+				slice = left
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			if left := time.Until(deadline); left < slice {
+				slice = left
+			}
+		}
+		if !end.IsZero() {
+			if left := time.Until(end); left < slice {
+				slice = left
+			}
+		}
+		millis := 0
+		if slice > 0 {
+			millis = int((slice + time.Millisecond - 1) / time.Millisecond)
+		}
+		// Execute the read operation for the current slice
+		handle, err := dev.acquire()
+		if err != nil {
+			return 0, err
+		}
+		read, err := handle.readTimeout(b, millis)
+		dev.release()
+
+		if err != nil {
+			return 0, dev.failure(err)
+		}
+		if read > 0 {
+			return read, nil
+		}
+		if !end.IsZero() && !time.Now().Before(end) {
+			return 0, nil
+		}
+	}
+}
+
+// SetDeadline sets both the read and write deadlines of the device.
+func (dev *device) SetDeadline(t time.Time) error {
+	dev.lock.Lock()
+	defer dev.lock.Unlock()
+
+	dev.readDeadline, dev.writeDeadline = t, t
+	return nil
+}
+
+// SetReadDeadline sets the deadline for current and future Read calls. A zero
+// value disables the deadline.
+func (dev *device) SetReadDeadline(t time.Time) error {
+	dev.lock.Lock()
+	defer dev.lock.Unlock()
+
+	dev.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write calls. A zero value
+// disables the deadline.
+func (dev *device) SetWriteDeadline(t time.Time) error {
+	dev.lock.Lock()
+	defer dev.lock.Unlock()
+
+	dev.writeDeadline = t
+	return nil
+}
+
+// SendFeatureReport sends a feature report to a HID device
+//
+// Feature reports are sent over the Control endpoint as a Set_Report transfer.
+// The first byte of b must contain the Report ID. For devices which only
+// support a single report, this must be set to 0x0. The remaining bytes
+// contain the report data. Since the Report ID is mandatory, calls to
+// SendFeatureReport() will always contain one more byte than the report
+// contains. For example, if a hid report is 16 bytes long, 17 bytes must be
+// passed to SendFeatureReport(): the Report ID (or 0x0, for devices
+// which do not use numbered reports), followed by the report data (16 bytes).
+// In this example, the length passed in would be 17.
+func (dev *device) SendFeatureReport(b []byte) (int, error) {
+	// Abort if nothing to write
+	if len(b) == 0 {
+		return 0, nil
+	}
+	handle, err := dev.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer dev.release()
+
+	written, err := handle.sendFeatureReport(b)
+	return written, dev.failure(err)
+}
+
+// GetFeatureReport retreives a feature report from a HID device
+//
+// Set the first byte of []b to the Report ID of the report to be read. Make
+// sure to allow space for this extra byte in []b. Upon return, the first byte
+// will still contain the Report ID, and the report data will start in b[1].
+func (dev *device) GetFeatureReport(b []byte) (int, error) {
+	// Abort if we don't have anywhere to write the results
+	if len(b) == 0 {
+		return 0, nil
+	}
+	handle, err := dev.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer dev.release()
+
+	read, err := handle.getFeatureReport(b)
+	return read, dev.failure(err)
+}
+
+// GetInputReport retrieves an input report from a HID device through a control
+// transfer, useful for devices that only answer polled input reports.
+//
+// Set the first byte of []b to the Report ID of the report to be read. Make
+// sure to allow space for this extra byte in []b. Upon return, the first byte
+// will still contain the Report ID, and the report data will start in b[1].
+func (dev *device) GetInputReport(b []byte) (int, error) {
+	// Abort if we don't have anywhere to write the results
+	if len(b) == 0 {
+		return 0, nil
+	}
+	handle, err := dev.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer dev.release()
+
+	read, err := handle.getInputReport(b)
+	return read, dev.failure(err)
+}
+
+// GetReportDescriptor retrieves the raw HID report descriptor of the device.
+func (dev *device) GetReportDescriptor() ([]byte, error) {
+	handle, err := dev.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer dev.release()
+
+	desc, err := handle.getReportDescriptor()
+	return desc, dev.failure(err)
+}
+
+// Info retrieves the device details directly from the open device handle, rather
+// than relying on the enumeration snapshot the device was opened with.
+func (dev *device) Info() (DeviceInfo, error) {
+	handle, err := dev.acquire()
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	defer dev.release()
+
+	info, err := handle.info()
+	return info, dev.failure(err)
+}
+
+// Manufacturer retrieves the manufacturer string directly from the device.
+func (dev *device) Manufacturer() (string, error) {
+	return dev.getString(handle.manufacturer)
+}
+
+// Product retrieves the product string directly from the device.
+func (dev *device) Product() (string, error) {
+	return dev.getString(handle.product)
+}
+
+// SerialNumber retrieves the serial number string directly from the device.
+func (dev *device) SerialNumber() (string, error) {
+	return dev.getString(handle.serialNumber)
+}
+
+// IndexedString retrieves an arbitrary string descriptor from the device by its
+// USB string index.
+func (dev *device) IndexedString(index int) (string, error) {
+	return dev.getString(func(h handle) (string, error) {
+		return h.indexedString(index)
+	})
+}
+
+// getString retrieves a string from the device via one of the handle's string
+// getter methods.
+func (dev *device) getString(getter func(handle) (string, error)) (string, error) {
+	handle, err := dev.acquire()
+	if err != nil {
+		return "", err
+	}
+	defer dev.release()
+
+	str, err := getter(handle)
+	return str, dev.failure(err)
+}
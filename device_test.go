@@ -0,0 +1,394 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeHandle is a native device handle emulation, tracking whether any calls are
+// made concurrently with or after closing it.
+type fakeHandle struct {
+	reports chan []byte   // Input reports to hand out to readers
+	delay   time.Duration // Time each write blocks for
+
+	inflight   int32 // Number of calls currently executing
+	closed     int32 // Whether the handle was already closed
+	violations int32 // Number of calls made on a closed handle
+}
+
+func newFakeHandle() *fakeHandle {
+	return &fakeHandle{reports: make(chan []byte, 16)}
+}
+
+func (h *fakeHandle) enter() {
+	if atomic.LoadInt32(&h.closed) != 0 {
+		atomic.AddInt32(&h.violations, 1)
+	}
+	atomic.AddInt32(&h.inflight, 1)
+}
+
+func (h *fakeHandle) exit() {
+	atomic.AddInt32(&h.inflight, -1)
+}
+
+func (h *fakeHandle) close() error {
+	if atomic.LoadInt32(&h.inflight) != 0 || !atomic.CompareAndSwapInt32(&h.closed, 0, 1) {
+		atomic.AddInt32(&h.violations, 1)
+	}
+	return nil
+}
+
+func (h *fakeHandle) write(b []byte) (int, error) {
+	h.enter()
+	defer h.exit()
+
+	time.Sleep(h.delay)
+	return len(b), nil
+}
+
+func (h *fakeHandle) readTimeout(b []byte, timeout int) (int, error) {
+	h.enter()
+	defer h.exit()
+
+	select {
+	case report := <-h.reports:
+		return copy(b, report), nil
+	case <-time.After(time.Duration(timeout) * time.Millisecond):
+		return 0, nil
+	}
+}
+
+func (h *fakeHandle) sendFeatureReport(b []byte) (int, error) {
+	h.enter()
+	defer h.exit()
+	return len(b), nil
+}
+
+func (h *fakeHandle) getFeatureReport(b []byte) (int, error) {
+	h.enter()
+	defer h.exit()
+	return len(b), nil
+}
+
+func (h *fakeHandle) getInputReport(b []byte) (int, error) {
+	h.enter()
+	defer h.exit()
+	return len(b), nil
+}
+
+func (h *fakeHandle) getReportDescriptor() ([]byte, error) {
+	h.enter()
+	defer h.exit()
+	return []byte{0x06, 0x00, 0xff}, nil
+}
+
+func (h *fakeHandle) info() (DeviceInfo, error) {
+	h.enter()
+	defer h.exit()
+	return DeviceInfo{Path: "fake"}, nil
+}
+
+func (h *fakeHandle) manufacturer() (string, error)     { return h.str() }
+func (h *fakeHandle) product() (string, error)          { return h.str() }
+func (h *fakeHandle) serialNumber() (string, error)     { return h.str() }
+func (h *fakeHandle) indexedString(int) (string, error) { return h.str() }
+
+func (h *fakeHandle) str() (string, error) {
+	h.enter()
+	defer h.exit()
+	return "fake", nil
+}
+
+// Tests that closing a device wakes up blocked readers, which return with the
+// closed error instead of hanging.
+func TestDeviceCloseUnblocksRead(t *testing.T) {
+	dev := newDevice(DeviceInfo{}, newFakeHandle())
+
+	errc := make(chan error, 2)
+	go func() {
+		_, err := dev.Read(make([]byte, 64))
+		errc <- err
+	}()
+	go func() {
+		_, err := dev.ReadTimeout(make([]byte, 64), 60000)
+		errc <- err
+	}()
+	time.Sleep(2 * readPollInterval)
+	if err := dev.Close(); err != nil {
+		t.Fatalf("failed to close device: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != ErrDeviceClosed {
+				t.Errorf("reader %d: error mismatch: have %v, want %v", i, err, ErrDeviceClosed)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("reader %d: not unblocked by close", i)
+		}
+	}
+}
+
+// Tests that concurrently hammering a device with operations while closing it
+// never results in the native handle being used after (or while) closing.
+func TestDeviceCloseRace(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		var (
+			handle = newFakeHandle()
+			dev    = newDevice(DeviceInfo{}, handle)
+			pend   sync.WaitGroup
+		)
+		handle.delay = time.Millisecond
+
+		ops := []func() error{
+			func() error { _, err := dev.Read(make([]byte, 8)); return err },
+			func() error { _, err := dev.ReadTimeout(make([]byte, 8), 1); return err },
+			func() error { _, err := dev.Write([]byte{0x00, 0x01}); return err },
+			func() error { _, err := dev.SendFeatureReport([]byte{0x00, 0x01}); return err },
+			func() error { _, err := dev.GetFeatureReport(make([]byte, 8)); return err },
+			func() error { _, err := dev.GetInputReport(make([]byte, 8)); return err },
+			func() error { _, err := dev.GetReportDescriptor(); return err },
+			func() error { _, err := dev.Info(); return err },
+			func() error { _, err := dev.Product(); return err },
+		}
+		errs := make([]error, len(ops))
+		for j, op := range ops {
+			pend.Add(1)
+			go func(j int, op func() error) {
+				defer pend.Done()
+				for {
+					if err := op(); err != nil {
+						errs[j] = err
+						return
+					}
+				}
+			}(j, op)
+		}
+		for j := 0; j < 4; j++ {
+			handle.reports <- []byte{byte(j)}
+		}
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		if err := dev.Close(); err != nil {
+			t.Fatalf("iter %d: failed to close device: %v", i, err)
+		}
+		pend.Wait()
+
+		if v := atomic.LoadInt32(&handle.violations); v != 0 {
+			t.Fatalf("iter %d: handle used after close %d times", i, v)
+		}
+		for j, err := range errs {
+			if err != ErrDeviceClosed {
+				t.Errorf("iter %d, op %d: error mismatch: have %v, want %v", i, j, err, ErrDeviceClosed)
+			}
+		}
+	}
+}
+
+// Tests that read deadlines and contexts interrupt reads with the right errors,
+// and that data arriving in time is still delivered.
+func TestDeviceReadDeadline(t *testing.T) {
+	handle := newFakeHandle()
+	dev := newDevice(DeviceInfo{}, handle)
+	defer dev.Close()
+
+	buf := make([]byte, 8)
+
+	dev.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := dev.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("deadline error mismatch: have %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	dev.SetReadDeadline(time.Time{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := dev.ReadContext(ctx, buf); err != context.DeadlineExceeded {
+		t.Errorf("context error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n, err := dev.ReadTimeout(buf, 20); n != 0 || err != nil {
+		t.Errorf("timeout result mismatch: have %d, %v, want 0, nil", n, err)
+	}
+	handle.reports <- []byte{0x01, 0x02}
+	if n, err := dev.ReadContext(context.Background(), buf); n != 2 || err != nil {
+		t.Errorf("read result mismatch: have %d, %v, want 2, nil", n, err)
+	}
+}
+
+// Tests that write deadlines and contexts abandon writes blocking for too long.
+func TestDeviceWriteDeadline(t *testing.T) {
+	handle := newFakeHandle()
+	handle.delay = 200 * time.Millisecond
+
+	dev := newDevice(DeviceInfo{}, handle)
+	defer dev.Close()
+
+	dev.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := dev.Write([]byte{0x00}); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("deadline error mismatch: have %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	dev.SetWriteDeadline(time.Time{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := dev.WriteContext(ctx, []byte{0x00}); err != context.DeadlineExceeded {
+		t.Errorf("context error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n, err := dev.Write([]byte{0x00, 0x01}); n != 2 || err != nil {
+		t.Errorf("write result mismatch: have %d, %v, want 2, nil", n, err)
+	}
+}
+
+// Tests that cancelling the context of a blocked read or write returns promptly
+// with the context's error.
+func TestDeviceContextCancel(t *testing.T) {
+	handle := newFakeHandle()
+	handle.delay = time.Second
+
+	dev := newDevice(DeviceInfo{}, handle)
+	defer dev.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 2)
+	go func() {
+		_, err := dev.ReadContext(ctx, make([]byte, 8))
+		errc <- err
+	}()
+	go func() {
+		_, err := dev.WriteContext(ctx, []byte{0x00})
+		errc <- err
+	}()
+	time.Sleep(2 * readPollInterval)
+	cancel()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != context.Canceled {
+				t.Errorf("op %d: error mismatch: have %v, want %v", i, err, context.Canceled)
+			}
+		case <-time.After(2 * readPollInterval):
+			t.Fatalf("op %d: not unblocked by cancellation", i)
+		}
+	}
+}
+
+// Tests that reads and writes with an already expired context fail immediately,
+// without touching the device.
+func TestDeviceContextExpired(t *testing.T) {
+	handle := newFakeHandle()
+	handle.delay = time.Second
+	handle.reports <- []byte{0x01}
+
+	dev := newDevice(DeviceInfo{}, handle)
+	defer dev.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if _, err := dev.ReadContext(ctx, make([]byte, 8)); err != context.Canceled {
+		t.Errorf("read error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if _, err := dev.WriteContext(ctx, []byte{0x00}); err != context.Canceled {
+		t.Errorf("write error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > readPollInterval {
+		t.Errorf("expired context not failed fast: took %v", elapsed)
+	}
+	if len(handle.reports) != 1 {
+		t.Errorf("queued report consumed by cancelled read")
+	}
+}
+
+// Tests that both reads and writes fail with os.ErrDeadlineExceeded once the
+// shared deadline set via SetDeadline passes.
+func TestDeviceDeadlineExceeded(t *testing.T) {
+	handle := newFakeHandle()
+	handle.delay = time.Second
+
+	dev := newDevice(DeviceInfo{}, handle)
+	defer dev.Close()
+
+	dev.SetDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := dev.Read(make([]byte, 8)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("read error mismatch: have %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	dev.SetDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := dev.Write([]byte{0x00}); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("write error mismatch: have %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+}
+
+// Tests that deadlines already in the past fail reads and writes immediately,
+// without touching the device.
+func TestDeviceDeadlinePast(t *testing.T) {
+	handle := newFakeHandle()
+	handle.delay = time.Second
+	handle.reports <- []byte{0x01}
+
+	dev := newDevice(DeviceInfo{}, handle)
+	defer dev.Close()
+
+	dev.SetDeadline(time.Now().Add(-time.Second))
+
+	start := time.Now()
+	if _, err := dev.Read(make([]byte, 8)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("read error mismatch: have %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	if _, err := dev.Write([]byte{0x00}); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("write error mismatch: have %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > readPollInterval {
+		t.Errorf("past deadline not failed fast: took %v", elapsed)
+	}
+	if len(handle.reports) != 1 {
+		t.Errorf("queued report consumed despite past deadline")
+	}
+}
+
+// Tests that setting the zero time clears previously set deadlines, letting reads
+// and writes block past them again.
+func TestDeviceDeadlineClear(t *testing.T) {
+	handle := newFakeHandle()
+	handle.delay = 50 * time.Millisecond
+
+	dev := newDevice(DeviceInfo{}, handle)
+	defer dev.Close()
+
+	dev.SetDeadline(time.Now().Add(-time.Second))
+	dev.SetDeadline(time.Time{})
+
+	go func() {
+		time.Sleep(2 * readPollInterval)
+		handle.reports <- []byte{0x01, 0x02}
+	}()
+	if n, err := dev.Read(make([]byte, 8)); n != 2 || err != nil {
+		t.Errorf("read result mismatch: have %d, %v, want 2, nil", n, err)
+	}
+	if n, err := dev.Write([]byte{0x00, 0x01}); n != 2 || err != nil {
+		t.Errorf("write result mismatch: have %d, %v, want 2, nil", n, err)
+	}
+	// Clearing the read and write deadlines individually should work too
+	dev.SetReadDeadline(time.Now().Add(-time.Second))
+	dev.SetWriteDeadline(time.Now().Add(-time.Second))
+	dev.SetReadDeadline(time.Time{})
+	dev.SetWriteDeadline(time.Time{})
+
+	handle.reports <- []byte{0x03}
+	if n, err := dev.Read(make([]byte, 8)); n != 1 || err != nil {
+		t.Errorf("read result mismatch: have %d, %v, want 1, nil", n, err)
+	}
+	if n, err := dev.Write([]byte{0x00}); n != 1 || err != nil {
+		t.Errorf("write result mismatch: have %d, %v, want 1, nil", n, err)
+	}
+}
@@ -0,0 +1,93 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+)
+
+var (
+	// ErrPermissionDenied is matched by errors caused by insufficient access
+	// rights to the device (e.g. missing udev rules on Linux).
+	ErrPermissionDenied = errors.New("hid: permission denied")
+
+	// ErrDeviceNotFound is matched by errors caused by a device path that does
+	// not (or no longer) exist.
+	ErrDeviceNotFound = errors.New("hid: device not found")
+
+	// ErrDeviceBusy is matched by errors caused by a device being opened for
+	// exclusive access by someone else.
+	ErrDeviceBusy = errors.New("hid: device busy")
+
+	// ErrDisconnected is matched by errors caused by a device being unplugged
+	// while in use.
+	ErrDisconnected = errors.New("hid: device disconnected")
+)
+
+// Error is a failure reported by the platform HID library. It matches the error
+// sentinels of this package via errors.Is, and unwraps to the system errno.
+type Error struct {
+	Op    string        // Operation that failed (open, read, write, get_feature, ...)
+	Path  string        // Platform specific path of the device
+	Msg   string        // Error message reported by the platform library, if any
+	Errno syscall.Errno // Underlying system error number, 0 if not available
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	msg := "hid: " + e.Op
+	if e.Path != "" {
+		msg += " " + e.Path
+	}
+	switch {
+	case e.Msg != "" && e.Errno != 0:
+		return msg + ": " + e.Msg + " (" + e.Errno.Error() + ")"
+	case e.Msg != "":
+		return msg + ": " + e.Msg
+	case e.Errno != 0:
+		return msg + ": " + e.Errno.Error()
+	default:
+		return msg + ": unknown failure"
+	}
+}
+
+// Unwrap returns the underlying system error number, if any.
+func (e *Error) Unwrap() error {
+	if e.Errno == 0 {
+		return nil
+	}
+	return e.Errno
+}
+
+// Is reports whether the error matches one of the package's error sentinels.
+func (e *Error) Is(target error) bool {
+	return target != nil && e.kind() == target
+}
+
+// kind classifies the error into one of the package's error sentinels, or nil if
+// the cause cannot be determined. The errno is authoritative if it's known, else
+// the message of the platform library is inspected.
+func (e *Error) kind() error {
+	if e.Errno != 0 {
+		if kind := errnoKind(e.Errno); kind != nil {
+			return kind
+		}
+	}
+	msg := strings.ToLower(e.Msg)
+	switch {
+	case strings.Contains(msg, "disconnected") || strings.Contains(msg, "not connected") || strings.Contains(msg, "no such device"):
+		return ErrDisconnected
+	case strings.Contains(msg, "not found"):
+		return ErrDeviceNotFound
+	case strings.Contains(msg, "access denied") || strings.Contains(msg, "access is denied") || strings.Contains(msg, "not permitted") || strings.Contains(msg, "privilege"):
+		return ErrPermissionDenied
+	case strings.Contains(msg, "exclusive access") || strings.Contains(msg, "busy") || strings.Contains(msg, "being used by another process"):
+		return ErrDeviceBusy
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+//go:build plan9 || wasip1
+// +build plan9 wasip1
+
+package hid
+
+import "syscall"
+
+// errnoKind classifies a system error into one of the package's error sentinels,
+// which is not supported on Plan 9 and WASI.
+func errnoKind(errno syscall.Errno) error {
+	return nil
+}
+
+// platformErrno extracts the system error code of a failure, which is not
+// supported on Plan 9 and WASI.
+func platformErrno(msg string, errno syscall.Errno) syscall.Errno {
+	return 0
+}
@@ -0,0 +1,33 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+//go:build !windows && !plan9 && !wasip1
+// +build !windows,!plan9,!wasip1
+
+package hid
+
+import "syscall"
+
+// errnoKind classifies a POSIX errno into one of the package's error sentinels,
+// or nil if it's not a known cause.
+func errnoKind(errno syscall.Errno) error {
+	switch errno {
+	case syscall.EACCES, syscall.EPERM:
+		return ErrPermissionDenied
+	case syscall.ENOENT:
+		return ErrDeviceNotFound
+	case syscall.EBUSY:
+		return ErrDeviceBusy
+	case syscall.ENODEV, syscall.ENXIO, syscall.ESHUTDOWN:
+		return ErrDisconnected
+	}
+	return nil
+}
+
+// platformErrno extracts the system error code of a failure, which on POSIX
+// systems is the errno left behind by the platform library.
+func platformErrno(msg string, errno syscall.Errno) syscall.Errno {
+	return errno
+}
@@ -0,0 +1,70 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// Tests that errors are classified into the package sentinels based on the
+// messages reported by the various hidapi backends.
+func TestErrorMessageKind(t *testing.T) {
+	tests := []struct {
+		msg  string
+		kind error
+	}{
+		{"hid_read_timeout: device disconnected", ErrDisconnected},
+		{"Device is disconnected", ErrDisconnected},
+		{"hid_open_path: device mach entry not found with the given path", ErrDeviceNotFound},
+		{"hid_open_path: failed to open IOHIDDevice from mach entry: (0xE00002C5) (iokit/common) exclusive access and device already open", ErrDeviceBusy},
+		{"hid_open_path: failed to open IOHIDDevice from mach entry: (0xE00002E2) (iokit/common) not permitted", ErrPermissionDenied},
+		{"IOHIDDeviceSetReport failed: (0xE00002BC) (iokit/common) general error", nil},
+		{"", nil},
+	}
+	sentinels := []error{ErrPermissionDenied, ErrDeviceNotFound, ErrDeviceBusy, ErrDisconnected}
+	for _, tt := range tests {
+		err := &Error{Op: "open", Path: "fake", Msg: tt.msg}
+		for _, sentinel := range sentinels {
+			if have, want := errors.Is(err, sentinel), sentinel == tt.kind; have != want {
+				t.Errorf("%q: match %v mismatch: have %v, want %v", tt.msg, sentinel, have, want)
+			}
+		}
+	}
+}
+
+// Tests that errors carrying an errno are classified by it, and that they unwrap
+// to the errno to allow matching standard library errors too.
+func TestErrorErrnoKind(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("errno classification is POSIX specific")
+	}
+	err := error(&Error{Op: "open", Path: "/dev/bus/usb/001/002", Errno: syscall.EACCES})
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("permission error not matched")
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("standard permission error not matched")
+	}
+	if errors.Is(err, ErrDisconnected) {
+		t.Errorf("permission error matched as disconnection")
+	}
+	if have, want := err.Error(), "hid: open /dev/bus/usb/001/002: "+syscall.EACCES.Error(); have != want {
+		t.Errorf("message mismatch: have %q, want %q", have, want)
+	}
+	for _, errno := range []syscall.Errno{syscall.ENODEV, syscall.ENXIO} {
+		if err := error(&Error{Op: "read", Errno: errno}); !errors.Is(err, ErrDisconnected) {
+			t.Errorf("%v: disconnection error not matched", errno)
+		}
+	}
+	// Broken pipes are transient stalls on some platforms, not unplugs
+	if err := error(&Error{Op: "write", Errno: syscall.EPIPE}); errors.Is(err, ErrDisconnected) {
+		t.Errorf("broken pipe matched as disconnection")
+	}
+}
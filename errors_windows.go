@@ -0,0 +1,42 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// errnoKind classifies a Windows system error code into one of the package's
+// error sentinels, or nil if it's not a known cause.
+func errnoKind(errno syscall.Errno) error {
+	switch errno {
+	case 5: // ERROR_ACCESS_DENIED
+		return ErrPermissionDenied
+	case 2, 3: // ERROR_FILE_NOT_FOUND, ERROR_PATH_NOT_FOUND
+		return ErrDeviceNotFound
+	case 32, 170: // ERROR_SHARING_VIOLATION, ERROR_BUSY
+		return ErrDeviceBusy
+	case 31, 1167, 1617: // ERROR_GEN_FAILURE, ERROR_DEVICE_NOT_CONNECTED, ERROR_DEVICE_REMOVED
+		return ErrDisconnected
+	}
+	return nil
+}
+
+// platformErrno extracts the system error code of a failure. On Windows hidapi
+// embeds GetLastError into the message as "op: (0x%08X) text", errno is unused.
+func platformErrno(msg string, errno syscall.Errno) syscall.Errno {
+	start := strings.Index(msg, "(0x")
+	if start < 0 || len(msg) < start+12 || msg[start+11] != ')' {
+		return 0
+	}
+	code, err := strconv.ParseUint(msg[start+3:start+11], 16, 32)
+	if err != nil {
+		return 0
+	}
+	return syscall.Errno(code)
+}
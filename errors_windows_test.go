@@ -0,0 +1,36 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"errors"
+	"testing"
+)
+
+// Tests that Windows system error codes are extracted from hidapi messages and
+// used to classify the errors.
+func TestErrorWindowsCode(t *testing.T) {
+	tests := []struct {
+		msg  string
+		code uint32
+		kind error
+	}{
+		{"WriteFile: (0x0000048F) The device is not connected.", 1167, ErrDisconnected},
+		{"open_device: (0x00000005) Access is denied.", 5, ErrPermissionDenied},
+		{"open_device: (0x00000020) The process cannot access the file because it is being used by another process.", 32, ErrDeviceBusy},
+		{"HidP_GetCaps", 0, nil},
+	}
+	for _, tt := range tests {
+		errno := platformErrno(tt.msg, 0)
+		if uint32(errno) != tt.code {
+			t.Errorf("%q: code mismatch: have %#x, want %#x", tt.msg, uint32(errno), tt.code)
+		}
+		err := &Error{Op: "open", Msg: tt.msg, Errno: errno}
+		if tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Errorf("%q: error not matched as %v", tt.msg, tt.kind)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrAmbiguousDevice is returned by OpenFirst if the filter matches more than
+// one physical device.
+var ErrAmbiguousDevice = errors.New("hid: multiple devices match")
+
+// Filter is a set of criteria to match HID devices against. A device matches if
+// it satisfies all the criteria. Zero valued fields match any device.
+type Filter struct {
+	VendorID  uint16  // Device Vendor ID to match
+	ProductID uint16  // Device Product ID to match
+	BusType   BusType // Underlying bus to match, BusUnknown matches all
+
+	// UsagePage and Usage are the top level usage page and usage to match. The
+	// default libusb backend on Linux does not report them when enumerating, so
+	// they never match any device there.
+	UsagePage uint16
+	Usage     uint16
+
+	// Interfaces is the list of USB interface numbers to match.
+	Interfaces []int
+
+	// Serial is the serial number to match, either exactly or as a glob pattern
+	// in path.Match syntax (e.g. "SN01*").
+	Serial string
+
+	// Manufacturer and Product are case insensitive substrings to look for in
+	// the manufacturer and product strings.
+	Manufacturer string
+	Product      string
+
+	// MinRelease and MaxRelease are the inclusive bounds of the release number
+	// to match. A zero MaxRelease means no upper bound.
+	MinRelease uint16
+	MaxRelease uint16
+
+	// Predicate is an arbitrary custom criteria, called only for devices which
+	// matched all the other criteria.
+	Predicate func(info DeviceInfo) bool
+}
+
+// Match returns whether a device satisfies all the criteria of the filter.
+func (f Filter) Match(info DeviceInfo) bool {
+	if f.VendorID != 0 && info.VendorID != f.VendorID {
+		return false
+	}
+	if f.ProductID != 0 && info.ProductID != f.ProductID {
+		return false
+	}
+	if f.UsagePage != 0 && info.UsagePage != f.UsagePage {
+		return false
+	}
+	if f.Usage != 0 && info.Usage != f.Usage {
+		return false
+	}
+	if f.BusType != BusUnknown && info.BusType != f.BusType {
+		return false
+	}
+	if len(f.Interfaces) > 0 {
+		var found bool
+		for _, iface := range f.Interfaces {
+			if info.Interface == iface {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Serial != "" && info.Serial != f.Serial {
+		// Not an exact match, try it as a glob pattern (invalid ones never match)
+		if ok, err := path.Match(f.Serial, info.Serial); err != nil || !ok {
+			return false
+		}
+	}
+	if f.Manufacturer != "" && !strings.Contains(strings.ToLower(info.Manufacturer), strings.ToLower(f.Manufacturer)) {
+		return false
+	}
+	if f.Product != "" && !strings.Contains(strings.ToLower(info.Product), strings.ToLower(f.Product)) {
+		return false
+	}
+	if info.Release < f.MinRelease || (f.MaxRelease != 0 && info.Release > f.MaxRelease) {
+		return false
+	}
+	if f.Predicate != nil && !f.Predicate(info) {
+		return false
+	}
+	return true
+}
+
+// EnumerateFilter returns a list of all the HID devices attached to the system
+// which match the given filter. Like Enumerate, if some backends fail, the matches
+// of the working ones are returned along with the error.
+func EnumerateFilter(filter Filter) ([]DeviceInfo, error) {
+	infos, err := Enumerate(filter.VendorID, filter.ProductID)
+
+	var matches []DeviceInfo
+	for _, info := range infos {
+		if filter.Match(info) {
+			matches = append(matches, info)
+		}
+	}
+	return matches, err
+}
+
+// OpenFirst connects to the HID device matching the given filter. If multiple
+// interfaces of the same physical device match, the one with the lowest path is
+// opened. If distinct devices match, ErrAmbiguousDevice is returned.
+//
+// Interfaces are grouped by vendor id, product id and serial number. Composite
+// devices without a serial number can only be grouped if their USB port can be
+// derived from the paths (libusb backend), otherwise matching more than one of
+// their interfaces is ambiguous and the filter needs to single out one of them
+// (e.g. via Interfaces or UsagePage).
+//
+// If any of the backends fail to enumerate their devices, the match cannot be
+// verified to be unique and the error is returned.
+func OpenFirst(filter Filter) (Device, error) {
+	infos, err := EnumerateFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	info, err := selectDevice(infos)
+	if err != nil {
+		return nil, err
+	}
+	return info.Open()
+}
+
+// selectDevice picks the device to open from a list of matches deterministically,
+// failing if there are no matches or if they belong to distinct physical devices.
+func selectDevice(infos []DeviceInfo) (DeviceInfo, error) {
+	if len(infos) == 0 {
+		return DeviceInfo{}, fmt.Errorf("%w: no device matches filter", ErrDeviceNotFound)
+	}
+	sorted := append([]DeviceInfo{}, infos...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	first := sorted[0]
+	for _, info := range sorted[1:] {
+		if !samePhysical(first, info) {
+			return DeviceInfo{}, fmt.Errorf("%w: %s and %s", ErrAmbiguousDevice, first.Path, info.Path)
+		}
+	}
+	return first, nil
+}
+
+// samePhysical reports whether two interfaces belong to the same physical device.
+// They must share the vendor id, product id and serial number, and also the USB
+// port if it can be derived from the paths. Without a serial number, interfaces
+// are only grouped if their USB port is known, otherwise they are considered to
+// be distinct devices. Currently the port is only known for libusb paths.
+func samePhysical(a, b DeviceInfo) bool {
+	if a.VendorID != b.VendorID || a.ProductID != b.ProductID || a.Serial != b.Serial {
+		return false
+	}
+	aport, bport := usbPort(a.Path), usbPort(b.Path)
+	if aport != "" && bport != "" {
+		return aport == bport
+	}
+	return a.Serial != ""
+}
+
+// usbPort extracts the USB port of a device from a libusb device path in the form
+// of "bus-port[.port]*:config.interface", returning "bus-port[.port]*". If the
+// path is in any other format, an empty string is returned.
+func usbPort(path string) string {
+	idx := strings.LastIndexByte(path, ':')
+	if idx < 0 {
+		return ""
+	}
+	port, iface := path[:idx], path[idx+1:]
+
+	config, number, ok := strings.Cut(iface, ".")
+	if !ok || !isDigits(config) || !isDigits(number) {
+		return ""
+	}
+	bus, hubs, ok := strings.Cut(port, "-")
+	if !ok || !isDigits(bus) {
+		return ""
+	}
+	for _, hub := range strings.Split(hubs, ".") {
+		if !isDigits(hub) {
+			return ""
+		}
+	}
+	return port
+}
+
+// isDigits returns whether a string is a non-empty sequence of decimal digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"errors"
+	"testing"
+)
+
+// Tests that filters match devices only if all their set criteria are met.
+func TestFilterMatch(t *testing.T) {
+	info := DeviceInfo{
+		VendorID:     0x1209,
+		ProductID:    0x53c1,
+		Release:      0x0210,
+		Serial:       "SN0123456",
+		Manufacturer: "SatoshiLabs",
+		Product:      "TREZOR",
+		UsagePage:    0xf1d0,
+		Usage:        0x01,
+		Interface:    1,
+		BusType:      BusBluetooth,
+	}
+	tests := []struct {
+		filter Filter
+		match  bool
+	}{
+		{Filter{}, true},
+		{Filter{VendorID: 0x1209}, true},
+		{Filter{VendorID: 0x1209, ProductID: 0x53c1}, true},
+		{Filter{VendorID: 0x1209, ProductID: 0x53c0}, false},
+		{Filter{VendorID: 0x2c97}, false},
+		{Filter{BusType: BusBluetooth}, true},
+		{Filter{BusType: BusUSB}, false},
+		{Filter{VendorID: 0x1209, BusType: BusUSB}, false},
+		{Filter{UsagePage: 0xf1d0, Usage: 0x01}, true},
+		{Filter{UsagePage: 0xf1d0, Usage: 0x02}, false},
+		{Filter{UsagePage: 0xff00}, false},
+		{Filter{Interfaces: []int{0, 1}}, true},
+		{Filter{Interfaces: []int{0}}, false},
+		{Filter{Serial: "SN0123456"}, true},
+		{Filter{Serial: "SN01*"}, true},
+		{Filter{Serial: "SN0?23456"}, true},
+		{Filter{Serial: "SN02*"}, false},
+		{Filter{Serial: "SN0123"}, false},
+		{Filter{Serial: "[SN"}, false},
+		{Filter{Manufacturer: "satoshi"}, true},
+		{Filter{Manufacturer: "ledger"}, false},
+		{Filter{Product: "trez"}, true},
+		{Filter{Product: "nano"}, false},
+		{Filter{MinRelease: 0x0200}, true},
+		{Filter{MinRelease: 0x0200, MaxRelease: 0x0210}, true},
+		{Filter{MinRelease: 0x0211}, false},
+		{Filter{MaxRelease: 0x0100}, false},
+		{Filter{Predicate: func(info DeviceInfo) bool { return info.Release&0xff == 0x10 }}, true},
+		{Filter{Predicate: func(info DeviceInfo) bool { return false }}, false},
+	}
+	for i, tt := range tests {
+		if have := tt.filter.Match(info); have != tt.match {
+			t.Errorf("test %d: match mismatch: have %v, want %v", i, have, tt.match)
+		}
+	}
+}
+
+// Tests that devices to open are selected deterministically, and that matches of
+// distinct physical devices are rejected as ambiguous.
+func TestSelectDevice(t *testing.T) {
+	var (
+		ifaceB = DeviceInfo{Path: "b", VendorID: 0x1209, ProductID: 0x53c1, Serial: "1234", Interface: 1}
+		ifaceA = DeviceInfo{Path: "a", VendorID: 0x1209, ProductID: 0x53c1, Serial: "1234", Interface: 0}
+		other  = DeviceInfo{Path: "c", VendorID: 0x1209, ProductID: 0x53c1, Serial: "5678"}
+		bare   = DeviceInfo{Path: "d", VendorID: 0x1209, ProductID: 0x53c1}
+	)
+	if info, err := selectDevice([]DeviceInfo{ifaceB, ifaceA}); err != nil || info.Path != "a" {
+		t.Errorf("interface selection mismatch: have %q, %v, want %q, nil", info.Path, err, "a")
+	}
+	if info, err := selectDevice([]DeviceInfo{bare}); err != nil || info.Path != "d" {
+		t.Errorf("single selection mismatch: have %q, %v, want %q, nil", info.Path, err, "d")
+	}
+	if _, err := selectDevice([]DeviceInfo{ifaceA, other}); !errors.Is(err, ErrAmbiguousDevice) {
+		t.Errorf("distinct serial error mismatch: have %v, want %v", err, ErrAmbiguousDevice)
+	}
+	if _, err := selectDevice([]DeviceInfo{bare, bare}); !errors.Is(err, ErrAmbiguousDevice) {
+		t.Errorf("missing serial error mismatch: have %v, want %v", err, ErrAmbiguousDevice)
+	}
+	if _, err := selectDevice(nil); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("no match error mismatch: have %v, want %v", err, ErrDeviceNotFound)
+	}
+	// Composite devices without serials are only grouped if their port is known
+	var (
+		composite0 = DeviceInfo{Path: "1-2.4:1.0", VendorID: 0x1209, ProductID: 0x53c1}
+		composite1 = DeviceInfo{Path: "1-2.4:1.1", VendorID: 0x1209, ProductID: 0x53c1}
+		neighbour  = DeviceInfo{Path: "1-2.3:1.1", VendorID: 0x1209, ProductID: 0x53c1}
+		hidraw0    = DeviceInfo{Path: "/dev/hidraw0", VendorID: 0x1209, ProductID: 0x53c1}
+		hidraw1    = DeviceInfo{Path: "/dev/hidraw1", VendorID: 0x1209, ProductID: 0x53c1}
+	)
+	if info, err := selectDevice([]DeviceInfo{composite1, composite0}); err != nil || info.Path != composite0.Path {
+		t.Errorf("composite selection mismatch: have %q, %v, want %q, nil", info.Path, err, composite0.Path)
+	}
+	if _, err := selectDevice([]DeviceInfo{composite0, neighbour}); !errors.Is(err, ErrAmbiguousDevice) {
+		t.Errorf("distinct port error mismatch: have %v, want %v", err, ErrAmbiguousDevice)
+	}
+	if _, err := selectDevice([]DeviceInfo{hidraw0, hidraw1}); !errors.Is(err, ErrAmbiguousDevice) {
+		t.Errorf("unknown port error mismatch: have %v, want %v", err, ErrAmbiguousDevice)
+	}
+	// Identical serials on distinct ports are distinct devices (e.g. cloned serials)
+	clone := composite0
+	clone.Path, clone.Serial = "2-1:1.0", "1234"
+	twin := composite1
+	twin.Serial = "1234"
+	if _, err := selectDevice([]DeviceInfo{clone, twin}); !errors.Is(err, ErrAmbiguousDevice) {
+		t.Errorf("cloned serial error mismatch: have %v, want %v", err, ErrAmbiguousDevice)
+	}
+}
+
+// Tests that USB ports are only extracted from well formed libusb paths.
+func TestUSBPort(t *testing.T) {
+	tests := []struct {
+		path string
+		port string
+	}{
+		{"1-2:1.0", "1-2"},
+		{"3-1.4.2:1.2", "3-1.4.2"},
+		{"/dev/hidraw0", ""},
+		{"DevSrvsID:4294969551", ""},
+		{"hidtest:fake1", ""},
+		{"remote:1-2:1.0", ""},
+		{"1-2:1", ""},
+		{"1-:1.0", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if have := usbPort(tt.path); have != tt.port {
+			t.Errorf("%q: port mismatch: have %q, want %q", tt.path, have, tt.port)
+		}
+	}
+}
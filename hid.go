@@ -7,7 +7,13 @@
 // Package hid provides an interface for USB HID devices.
 package hid
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/karalabe/hid/usage"
+)
 
 // ErrDeviceClosed is returned for operations where the device closed before or
 // during the execution.
@@ -17,6 +23,47 @@ var ErrDeviceClosed = errors.New("hid: device closed")
 // operating system is not supported by the library.
 var ErrUnsupportedPlatform = errors.New("hid: unsupported platform")
 
+// BusType is the underlying bus through which a HID device is connected.
+type BusType uint8
+
+// Bus types as reported by hidapi.
+const (
+	BusUnknown   BusType = 0x00 // Unknown bus type or not reported by the platform
+	BusUSB       BusType = 0x01 // USB, including devices attached through hubs
+	BusBluetooth BusType = 0x02 // Bluetooth or Bluetooth LE
+	BusI2C       BusType = 0x03 // I2C, following the Microsoft HID over I2C spec
+	BusSPI       BusType = 0x04 // SPI, following the Microsoft HID over SPI spec
+)
+
+// String implements fmt.Stringer.
+func (bus BusType) String() string {
+	switch bus {
+	case BusUSB:
+		return "USB"
+	case BusBluetooth:
+		return "Bluetooth"
+	case BusI2C:
+		return "I2C"
+	case BusSPI:
+		return "SPI"
+	default:
+		return "Unknown"
+	}
+}
+
+// LibraryVersion is the version of the native HID library in use.
+type LibraryVersion struct {
+	Major int    // Major version number
+	Minor int    // Minor version number
+	Patch int    // Patch version number
+	Text  string // Full version string, including any pre-release suffix
+}
+
+// String implements fmt.Stringer.
+func (v LibraryVersion) String() string {
+	return v.Text
+}
+
 // DeviceInfo contains all the information we know about a USB device.
 type DeviceInfo struct {
 	Path         string // Platform-specific device path
@@ -26,14 +73,27 @@ type DeviceInfo struct {
 	Serial       string // Serial Number
 	Manufacturer string // Manufacturer String
 	Product      string // Product string
-	UsagePage    uint16 // Usage Page for this Device/Interface (Windows/Mac only)
-	Usage        uint16 // Usage for this Device/Interface (Windows/Mac only)
+	UsagePage    uint16 // Usage Page for this Device/Interface (0 when enumerating via libusb)
+	Usage        uint16 // Usage for this Device/Interface (0 when enumerating via libusb)
 
 	// The USB interface which this logical device
 	// represents. Valid on both Linux implementations
 	// in all cases, and valid on the Windows implementation
 	// only if the device contains more than one interface.
 	Interface int
+
+	// BusType is the underlying bus through which the device is connected.
+	BusType BusType
+}
+
+// UsagePageName returns the human readable name of the device's usage page.
+func (info DeviceInfo) UsagePageName() string {
+	return usage.PageName(info.UsagePage)
+}
+
+// UsageName returns the human readable name of the device's top level usage.
+func (info DeviceInfo) UsageName() string {
+	return usage.Name(info.UsagePage, info.Usage)
 }
 
 // Device is a generic USB device interface. It may either be backed by a USB HID
@@ -43,17 +103,40 @@ type Device interface {
 	Close() error
 
 	// Write sends a binary blob to a USB device. For HID devices write uses reports,
-	// for low level USB write uses interrupt transfers.
+	// for low level USB write uses interrupt transfers. If the write deadline
+	// passes, os.ErrDeadlineExceeded is returned.
 	Write(b []byte) (int, error)
 
 	// Read retrieves a binary blob from a USB device. For HID devices read uses
-	// reports, for low level USB read uses interrupt transfers.
+	// reports, for low level USB read uses interrupt transfers. If the read
+	// deadline passes, os.ErrDeadlineExceeded is returned.
 	Read(b []byte) (int, error)
 
 	// Read retrieves a binary blob from a USB device, using a timeout. A timeout
 	// of 0 means blocking.
 	ReadTimeout(b []byte, timeout int) (int, error)
 
+	// SetDeadline sets the read and write deadlines of the device, equivalent to
+	// calling both SetReadDeadline and SetWriteDeadline. Deadlines behave like the
+	// ones of net.Conn, a zero value meaning no deadline.
+	SetDeadline(t time.Time) error
+
+	// SetReadDeadline sets the deadline for pending and future Read calls.
+	SetReadDeadline(t time.Time) error
+
+	// SetWriteDeadline sets the deadline for future Write calls. Since writes can
+	// not be interrupted inside the platform libraries, a write exceeding its
+	// deadline is abandoned in the background and may still reach the device.
+	SetWriteDeadline(t time.Time) error
+
+	// ReadContext retrieves a binary blob from a USB device, blocking until one
+	// arrives or the context is cancelled, in which case ctx.Err() is returned.
+	ReadContext(ctx context.Context, b []byte) (int, error)
+
+	// WriteContext sends a binary blob to a USB device, returning ctx.Err() if the
+	// context is cancelled before the write completes.
+	WriteContext(ctx context.Context, b []byte) (int, error)
+
 	// GetFeatureReport retreives a feature report from a HID device
 	//
 	// Set the first byte of []b to the Report ID of the report to be read. Make
@@ -61,6 +144,14 @@ type Device interface {
 	// will still contain the Report ID, and the report data will start in b[1].
 	GetFeatureReport(b []byte) (int, error)
 
+	// GetInputReport retrieves an input report from a HID device through a
+	// Get_Report(Input) control transfer, instead of the interrupt endpoint.
+	//
+	// Set the first byte of []b to the Report ID of the report to be read. Make
+	// sure to allow space for this extra byte in []b. Upon return, the first byte
+	// will still contain the Report ID, and the report data will start in b[1].
+	GetInputReport(b []byte) (int, error)
+
 	// SendFeatureReport sends a feature report to a HID device
 	//
 	// Feature reports are sent over the Control endpoint as a Set_Report transfer.
@@ -73,4 +164,25 @@ type Device interface {
 	// which do not use numbered reports), followed by the report data (16 bytes).
 	// In this example, the length passed in would be 17.
 	SendFeatureReport(b []byte) (int, error)
+
+	// Info retrieves the device details directly from the open device, which is
+	// useful if it was opened by a bare path instead of an enumerated DeviceInfo.
+	Info() (DeviceInfo, error)
+
+	// Manufacturer retrieves the manufacturer string directly from the device.
+	Manufacturer() (string, error)
+
+	// Product retrieves the product string directly from the device.
+	Product() (string, error)
+
+	// SerialNumber retrieves the serial number string directly from the device.
+	SerialNumber() (string, error)
+
+	// IndexedString retrieves an arbitrary string descriptor from the device by
+	// its USB string index.
+	IndexedString(index int) (string, error)
+
+	// GetReportDescriptor retrieves the raw HID report descriptor of the device,
+	// as reported by the operating system (or reconstructed from it on Windows).
+	GetReportDescriptor() ([]byte, error)
 }
@@ -4,27 +4,50 @@
 // This file is released under the 3-clause BSD license. Note however that Linux
 // support depends on libusb, released under GNU LGPL 2.1 or later.
 
-//go:build (!freebsd && !linux && !darwin && !windows) || ios || !cgo
-// +build !freebsd,!linux,!darwin,!windows ios !cgo
+//go:build (!freebsd && !linux && !darwin && !windows) || ios || (!cgo && !linux)
+// +build !freebsd,!linux,!darwin,!windows ios !cgo,!linux
 
 package hid
 
-// Supported returns whether this platform is supported by the HID library or not.
-// The goal of this method is to allow programatically handling platforms that do
-// not support USB HID and not having to fall back to build constraints.
-func Supported() bool {
+// nativeSupported returns whether the native HID backend is supported on this
+// platform or not.
+func nativeSupported() bool {
 	return false
 }
 
-// Enumerate returns a list of all the HID devices attached to the system which
-// match the vendor and product id. On platforms that this file implements the
-// function is a noop and returns an empty list always.
-func Enumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
+// Init initializes the native HID library. On platforms that this file implements
+// the function is a noop.
+func Init() error {
+	return nil
+}
+
+// Exit releases all the resources held by the native HID library. On platforms
+// that this file implements the function is a noop.
+func Exit() error {
+	return nil
+}
+
+// Version returns the version of the native HID library. On platforms that this
+// file implements there is no native library and the zero version is returned.
+func Version() LibraryVersion {
+	return LibraryVersion{}
+}
+
+// nativeEnumerate returns a list of all the HID devices attached to the system
+// which match the vendor and product id. On platforms that this file implements
+// the function is a noop and returns an empty list always.
+func nativeEnumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
 	return nil, nil
 }
 
-// Open connects to an HID device by its path name. On platforms that this file
-// implements the method just returns an error.
-func (info DeviceInfo) Open() (Device, error) {
+// nativeOpen connects to an HID device by its path name. On platforms that this
+// file implements the method just returns an error.
+func nativeOpen(info DeviceInfo) (Device, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// nativeOpenMatching connects to an HID device by its identifiers. On platforms
+// that this file implements the method just returns an error.
+func nativeOpenMatching(vendorID uint16, productID uint16, serial string) (Device, error) {
 	return nil, ErrUnsupportedPlatform
 }
@@ -11,9 +11,13 @@
 package hid
 
 /*
-Linux/hidapi requires the 'libudev' package. Fedora:`dnf install systemd-devel`, Ubuntu `apt install libhidapi-dev`.
+Linux/hidapi requires the 'libudev' package. Fedora:`dnf install systemd-devel`, Ubuntu `apt install libudev-dev`.
 However, we prefer to not require libudev, which is why `libusb` is included, and enabled
 specifically for the linux platform, below.
+
+Building with the 'hidraw' tag swaps libusb for the hidraw based implementation of
+hidapi, which does not detach kernel drivers and also sees Bluetooth and I2C devices,
+at the cost of linking against libudev.
 */
 
 /*
@@ -21,8 +25,11 @@ specifically for the linux platform, below.
 #cgo CFLAGS: -DDEFAULT_VISIBILITY=""
 #cgo CFLAGS: -DPOLL_NFDS_TYPE=int
 
-#cgo linux CFLAGS: -I./libusb/libusb -DOS_LINUX -D_GNU_SOURCE -DHAVE_SYS_TIME_H -DHAVE_CLOCK_GETTIME
-#cgo linux,!android LDFLAGS: -lrt
+#cgo linux CFLAGS: -DOS_LINUX -D_GNU_SOURCE
+#cgo linux,!hidraw CFLAGS: -I./libusb/libusb -DHAVE_SYS_TIME_H -DHAVE_CLOCK_GETTIME
+#cgo linux,!android,!hidraw LDFLAGS: -lrt
+#cgo linux,hidraw CFLAGS: -DOS_LINUX_HIDRAW
+#cgo linux,hidraw LDFLAGS: -ludev
 
 #cgo darwin CFLAGS: -DOS_DARWIN -DHAVE_SYS_TIME_H
 #cgo darwin LDFLAGS: -framework CoreFoundation -framework IOKit -lobjc
@@ -39,7 +46,10 @@ specifically for the linux platform, below.
 	#include <poll.h>
 #endif
 
-#ifdef OS_LINUX
+#ifdef OS_LINUX_HIDRAW
+	#include <stdarg.h>
+	#include "hidapi/linux/hid.c"
+#elif OS_LINUX
 	#include "os/events_posix.h"
 	#include "os/threads_posix.h"
 
@@ -74,9 +84,10 @@ specifically for the linux platform, below.
 import "C"
 
 import (
-	"errors"
+	"fmt"
 	"runtime"
 	"sync"
+	"syscall"
 	"unsafe"
 )
 
@@ -90,22 +101,72 @@ import (
 //	> "subsequent calls will cause the hid manager to release previously enumerated devices"
 var enumerateLock sync.Mutex
 
-// Supported returns whether this platform is supported by the HID library or not.
-// The goal of this method is to allow programatically handling platforms that do
-// not support HID and not having to fall back to build constraints.
-func Supported() bool {
+// openHandles is the number of native devices currently open, which must all be
+// closed before the library can be torn down. It is protected by enumerateLock.
+var openHandles int
+
+// nativeSupported returns whether the native HID backend is supported on this
+// platform or not.
+func nativeSupported() bool {
 	return true
 }
 
-// Enumerate returns a list of all the HID devices attached to the system which
-// match the vendor and product id:
-//   - If the vendor id is set to 0 then any vendor matches.
-//   - If the product id is set to 0 then any product matches.
-//   - If the vendor and product id are both 0, all HID devices are returned.
-func Enumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
+// Init initializes the native HID library. Calling it is optional, as it's done
+// implicitly when enumerating or opening devices, but it allows surfacing the
+// initialization errors early. Calling it multiple times is a noop.
+func Init() error {
+	enumerateLock.Lock()
+	defer enumerateLock.Unlock()
+
+	return initialize()
+}
+
+// initialize initializes the native HID library if not yet done. The caller must
+// hold the enumeration lock.
+func initialize() error {
+	if res, err := C.hid_init(); res != 0 {
+		return newError("init", "", C.hid_error(nil), err)
+	}
+	return nil
+}
+
+// Exit releases all the resources held by the native HID library, such as the
+// libusb context and its event threads on Linux. All devices must be closed prior
+// to calling it, otherwise an error is returned and the library is left intact.
+// The library is initialized again on the next use.
+func Exit() error {
+	enumerateLock.Lock()
+	defer enumerateLock.Unlock()
+
+	if openHandles > 0 {
+		return &Error{Op: "exit", Msg: fmt.Sprintf("%d devices still open", openHandles)}
+	}
+	if res, err := C.hid_exit(); res != 0 {
+		return newError("exit", "", C.hid_error(nil), err)
+	}
+	return nil
+}
+
+// Version returns the version of the native HID library.
+func Version() LibraryVersion {
+	version := C.hid_version()
+	return LibraryVersion{
+		Major: int(version.major),
+		Minor: int(version.minor),
+		Patch: int(version.patch),
+		Text:  C.GoString(C.hid_version_str()),
+	}
+}
+
+// nativeEnumerate returns a list of all the HID devices attached to the system
+// which match the vendor and product id, zero matching any.
+func nativeEnumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
 	enumerateLock.Lock()
 	defer enumerateLock.Unlock()
 
+	if err := initialize(); err != nil {
+		return nil, err
+	}
 	// Gather all device infos and ensure they are freed before returning
 	head := C.hid_enumerate(C.ushort(vendorID), C.ushort(productID))
 	if head == nil {
@@ -116,84 +177,132 @@ func Enumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
 	// Iterate the list and retrieve the device details
 	var infos []DeviceInfo
 	for ; head != nil; head = head.next {
-		info := DeviceInfo{
-			Path:      C.GoString(head.path),
-			VendorID:  uint16(head.vendor_id),
-			ProductID: uint16(head.product_id),
-			Release:   uint16(head.release_number),
-			UsagePage: uint16(head.usage_page),
-			Usage:     uint16(head.usage),
-			Interface: int(head.interface_number),
-		}
-		if head.serial_number != nil {
-			info.Serial, _ = wcharTToString(head.serial_number)
-		}
-		if head.product_string != nil {
-			info.Product, _ = wcharTToString(head.product_string)
-		}
-		if head.manufacturer_string != nil {
-			info.Manufacturer, _ = wcharTToString(head.manufacturer_string)
-		}
-		infos = append(infos, info)
+		infos = append(infos, newDeviceInfo(head))
 	}
 	return infos, nil
 }
 
-// Open connects to a previsouly discovered HID device.
-func (info DeviceInfo) Open() (Device, error) {
+// newDeviceInfo converts a hidapi device info struct into its Go counterpart.
+func newDeviceInfo(head *C.struct_hid_device_info) DeviceInfo {
+	info := DeviceInfo{
+		Path:      C.GoString(head.path),
+		VendorID:  uint16(head.vendor_id),
+		ProductID: uint16(head.product_id),
+		Release:   uint16(head.release_number),
+		UsagePage: uint16(head.usage_page),
+		Usage:     uint16(head.usage),
+		Interface: int(head.interface_number),
+		BusType:   BusType(head.bus_type),
+	}
+	if head.serial_number != nil {
+		info.Serial, _ = wcharTToString(head.serial_number)
+	}
+	if head.product_string != nil {
+		info.Product, _ = wcharTToString(head.product_string)
+	}
+	if head.manufacturer_string != nil {
+		info.Manufacturer, _ = wcharTToString(head.manufacturer_string)
+	}
+	return info
+}
+
+// nativeOpen connects to a previsouly discovered HID device.
+func nativeOpen(info DeviceInfo) (Device, error) {
 	enumerateLock.Lock()
 	defer enumerateLock.Unlock()
 
+	if err := initialize(); err != nil {
+		return nil, err
+	}
 	path := C.CString(info.Path)
 	defer C.free(unsafe.Pointer(path))
 
-	device := C.hid_open_path(path)
+	device, err := C.hid_open_path(path)
 	if device == nil {
-		return nil, errors.New("hidapi: failed to open device")
+		return nil, newError("open", info.Path, C.hid_error(nil), err)
 	}
-	return &hidDevice{
-		DeviceInfo: info,
-		device:     device,
-	}, nil
+	openHandles++
+	return newDevice(info, &hidapiHandle{device: device, path: info.Path}), nil
 }
 
-// hidDevice is a live HID USB connected device handle.
-type hidDevice struct {
-	DeviceInfo // Embed the infos for easier access
+// nativeOpenMatching connects to the first HID device matching the vendor id,
+// product id and serial number, without a prior enumeration. If the serial number
+// is empty, it's not used for matching.
+func nativeOpenMatching(vendorID uint16, productID uint16, serial string) (Device, error) {
+	enumerateLock.Lock()
+	defer enumerateLock.Unlock()
+
+	if err := initialize(); err != nil {
+		return nil, err
+	}
+	var wserial *C.wchar_t
+	if serial != "" {
+		wserial, _ = stringToWcharT(serial)
+		defer C.free(unsafe.Pointer(wserial))
+	}
+	device, err := C.hid_open(C.ushort(vendorID), C.ushort(productID), wserial)
+	if device == nil {
+		return nil, newError("open", "", C.hid_error(nil), err)
+	}
+	openHandles++
 
-	device *C.hid_device // Low level HID device to communicate through
-	lock   sync.Mutex
+	// Retrieve the device details, falling back to the known ones if unavailable
+	handle := &hidapiHandle{device: device}
+	info, err := handle.info()
+	if err != nil {
+		info = DeviceInfo{VendorID: vendorID, ProductID: productID, Serial: serial}
+	}
+	handle.path = info.Path
+	return newDevice(info, handle), nil
 }
 
-// Close releases the HID USB device handle.
-func (dev *hidDevice) Close() error {
-	dev.lock.Lock()
-	defer dev.lock.Unlock()
+// maxStringLength is the maximum number of wide characters retrieved for a string
+// descriptor. USB string descriptors are at most 126 UTF-16 code units long.
+const maxStringLength = 256
 
-	if dev.device != nil {
-		C.hid_close(dev.device)
-		dev.device = nil
-	}
-	return nil
+// hidapiHandle is a live HID USB connected device handle, backed by hidapi. Its
+// lifetime is managed by the device wrapping it.
+type hidapiHandle struct {
+	device *C.hid_device // Low level HID device to communicate through
+	path   string        // Platform specific path of the device, for errors
 }
 
-// Write sends an output report to a HID device.
-//
-// Write will send the data on the first OUT endpoint, if one exists. If it does
-// not, it will send the data through the Control Endpoint (Endpoint 0).
-func (dev *hidDevice) Write(b []byte) (int, error) {
-	// Abort if nothing to write
-	if len(b) == 0 {
-		return 0, nil
+// unimplementedError is the placeholder message the libusb backend of hidapi
+// reports for all failures, carrying no information.
+const unimplementedError = "hid_error is not implemented yet"
+
+// newError assembles the error of a failed hidapi call from the message reported
+// by hidapi and the errno left behind by the call.
+func newError(op string, path string, message *C.wchar_t, err error) error {
+	failure := &Error{Op: op, Path: path}
+	if message != nil {
+		if msg, _ := wcharTToString(message); msg != unimplementedError {
+			failure.Msg = msg
+		}
 	}
-	// Abort if device closed in between
-	dev.lock.Lock()
-	device := dev.device
-	dev.lock.Unlock()
+	errno, _ := err.(syscall.Errno)
+	failure.Errno = platformErrno(failure.Msg, errno)
+	return failure
+}
 
-	if device == nil {
-		return 0, ErrDeviceClosed
-	}
+// failure assembles the error of a failed hidapi call on the device.
+func (h *hidapiHandle) failure(op string, err error) error {
+	return newError(op, h.path, C.hid_error(h.device), err)
+}
+
+// close releases the HID USB device handle, serialized with Exit so the library
+// cannot be torn down while a handle is being closed.
+func (h *hidapiHandle) close() error {
+	enumerateLock.Lock()
+	defer enumerateLock.Unlock()
+
+	C.hid_close(h.device)
+	openHandles--
+	return nil
+}
+
+// write sends an output report to a HID device.
+func (h *hidapiHandle) write(b []byte) (int, error) {
 	// Prepend a HID report ID on Windows, other OSes don't need it
 	var report []byte
 	fixlen := 0
@@ -204,23 +313,10 @@ func (dev *hidDevice) Write(b []byte) (int, error) {
 		report = b
 	}
 	// Execute the write operation
-	written := int(C.hid_write(device, (*C.uchar)(&report[0]), C.size_t(len(report))))
+	res, err := C.hid_write(h.device, (*C.uchar)(&report[0]), C.size_t(len(report)))
+	written := int(res)
 	if written == -1 {
-		// If the write failed, verify if closed or other error
-		dev.lock.Lock()
-		device = dev.device
-		dev.lock.Unlock()
-
-		if device == nil {
-			return 0, ErrDeviceClosed
-		}
-		// Device not closed, some other error occurred
-		message := C.hid_error(device)
-		if message == nil {
-			return 0, errors.New("hidapi: unknown failure")
-		}
-		failure, _ := wcharTToString(message)
-		return 0, errors.New("hidapi: " + failure)
+		return 0, h.failure("write", err)
 	}
 	if written > 0 {
 		written += fixlen
@@ -228,134 +324,104 @@ func (dev *hidDevice) Write(b []byte) (int, error) {
 	return written, nil
 }
 
-// Read retrieves an input report from a HID device, blocking and waiting for a response
-func (dev *hidDevice) Read(b []byte) (int, error) {
-	return dev.ReadTimeout(b, -1)
+// readTimeout retrieves an input report from a HID device with a timeout.
+func (h *hidapiHandle) readTimeout(b []byte, timeout int) (int, error) {
+	read, err := C.hid_read_timeout(h.device, (*C.uchar)(&b[0]), C.size_t(len(b)), C.int(timeout))
+	if read == -1 {
+		return 0, h.failure("read", err)
+	}
+	return int(read), nil
 }
 
-// ReadTimeout retrieves an input report from a HID device with a timeout. If timeout is -1, a
-// blocking read is performed.
-func (dev *hidDevice) ReadTimeout(b []byte, timeout int) (int, error) {
-	// Abort if nothing to read
-	if len(b) == 0 {
-		return 0, nil
+// sendFeatureReport sends a feature report to a HID device.
+func (h *hidapiHandle) sendFeatureReport(b []byte) (int, error) {
+	written, err := C.hid_send_feature_report(h.device, (*C.uchar)(&b[0]), C.size_t(len(b)))
+	if written == -1 {
+		return 0, h.failure("send_feature", err)
 	}
-	// Abort if device closed in between
-	dev.lock.Lock()
-	device := dev.device
-	dev.lock.Unlock()
+	return int(written), nil
+}
 
-	if device == nil {
-		return 0, ErrDeviceClosed
-	}
-	// Execute the read operation
-	read := int(C.hid_read_timeout(device, (*C.uchar)(&b[0]), C.size_t(len(b)), C.int(timeout)))
+// getFeatureReport retrieves a feature report from a HID device.
+func (h *hidapiHandle) getFeatureReport(b []byte) (int, error) {
+	read, err := C.hid_get_feature_report(h.device, (*C.uchar)(&b[0]), C.size_t(len(b)))
 	if read == -1 {
-		// If the read failed, verify if closed or other error
-		dev.lock.Lock()
-		device = dev.device
-		dev.lock.Unlock()
-
-		if device == nil {
-			return 0, ErrDeviceClosed
-		}
-		// Device not closed, some other error occurred
-		message := C.hid_error(device)
-		if message == nil {
-			return 0, errors.New("hidapi: unknown failure")
-		}
-		failure, _ := wcharTToString(message)
-		return 0, errors.New("hidapi: " + failure)
+		return 0, h.failure("get_feature", err)
 	}
-	return read, nil
+	return int(read), nil
 }
 
-// SendFeatureReport sends a feature report to a HID device
-//
-// Feature reports are sent over the Control endpoint as a Set_Report transfer.
-// The first byte of b must contain the Report ID. For devices which only
-// support a single report, this must be set to 0x0. The remaining bytes
-// contain the report data. Since the Report ID is mandatory, calls to
-// SendFeatureReport() will always contain one more byte than the report
-// contains. For example, if a hid report is 16 bytes long, 17 bytes must be
-// passed to SendFeatureReport(): the Report ID (or 0x0, for devices
-// which do not use numbered reports), followed by the report data (16 bytes).
-// In this example, the length passed in would be 17.
-func (dev *hidDevice) SendFeatureReport(b []byte) (int, error) {
-	// Abort if nothing to write
-	if len(b) == 0 {
-		return 0, nil
-	}
-	// Abort if device closed in between
-	dev.lock.Lock()
-	device := dev.device
-	dev.lock.Unlock()
-
-	if device == nil {
-		return 0, ErrDeviceClosed
+// getInputReport retrieves an input report from a HID device via a control transfer.
+func (h *hidapiHandle) getInputReport(b []byte) (int, error) {
+	read, err := C.hid_get_input_report(h.device, (*C.uchar)(&b[0]), C.size_t(len(b)))
+	if read == -1 {
+		return 0, h.failure("get_input", err)
 	}
+	return int(read), nil
+}
 
-	// Send the feature report
-	written := int(C.hid_send_feature_report(device, (*C.uchar)(&b[0]), C.size_t(len(b))))
-	if written == -1 {
-		// If the write failed, verify if closed or other error
-		dev.lock.Lock()
-		device = dev.device
-		dev.lock.Unlock()
+// getReportDescriptor retrieves the raw HID report descriptor of the device.
+func (h *hidapiHandle) getReportDescriptor() ([]byte, error) {
+	// Retrieve the report descriptor into a maximally sized buffer
+	buffer := make([]byte, C.HID_API_MAX_REPORT_DESCRIPTOR_SIZE)
 
-		if device == nil {
-			return 0, ErrDeviceClosed
-		}
-		// Device not closed, some other error occurred
-		message := C.hid_error(device)
-		if message == nil {
-			return 0, errors.New("hidapi: unknown failure")
-		}
-		failure, _ := wcharTToString(message)
-		return 0, errors.New("hidapi: " + failure)
+	read, err := C.hid_get_report_descriptor(h.device, (*C.uchar)(&buffer[0]), C.size_t(len(buffer)))
+	if read == -1 {
+		return nil, h.failure("get_descriptor", err)
 	}
-	return written, nil
+	return buffer[:read], nil
 }
 
-// GetFeatureReport retreives a feature report from a HID device
-//
-// Set the first byte of []b to the Report ID of the report to be read. Make
-// sure to allow space for this extra byte in []b. Upon return, the first byte
-// will still contain the Report ID, and the report data will start in b[1].
-func (dev *hidDevice) GetFeatureReport(b []byte) (int, error) {
-	// Abort if we don't have anywhere to write the results
-	if len(b) == 0 {
-		return 0, nil
+// info retrieves the device details from the open device handle.
+func (h *hidapiHandle) info() (DeviceInfo, error) {
+	// The device info is owned and freed by hidapi together with the device
+	info, err := C.hid_get_device_info(h.device)
+	if info == nil {
+		return DeviceInfo{}, h.failure("get_info", err)
 	}
-	// Abort if device closed in between
-	dev.lock.Lock()
-	device := dev.device
-	dev.lock.Unlock()
+	return newDeviceInfo(info), nil
+}
 
-	if device == nil {
-		return 0, ErrDeviceClosed
-	}
+// manufacturer retrieves the manufacturer string from the device.
+func (h *hidapiHandle) manufacturer() (string, error) {
+	return h.getString(func(buffer *C.wchar_t, size C.size_t) (C.int, error) {
+		res, err := C.hid_get_manufacturer_string(h.device, buffer, size)
+		return res, err
+	})
+}
 
-	// Retrive the feature report
-	read := int(C.hid_get_feature_report(device, (*C.uchar)(&b[0]), C.size_t(len(b))))
-	if read == -1 {
-		// If the read failed, verify if closed or other error
-		dev.lock.Lock()
-		device = dev.device
-		dev.lock.Unlock()
+// product retrieves the product string from the device.
+func (h *hidapiHandle) product() (string, error) {
+	return h.getString(func(buffer *C.wchar_t, size C.size_t) (C.int, error) {
+		res, err := C.hid_get_product_string(h.device, buffer, size)
+		return res, err
+	})
+}
 
-		if device == nil {
-			return 0, ErrDeviceClosed
-		}
+// serialNumber retrieves the serial number string from the device.
+func (h *hidapiHandle) serialNumber() (string, error) {
+	return h.getString(func(buffer *C.wchar_t, size C.size_t) (C.int, error) {
+		res, err := C.hid_get_serial_number_string(h.device, buffer, size)
+		return res, err
+	})
+}
 
-		// Device not closed, some other error occured
-		message := C.hid_error(device)
-		if message == nil {
-			return 0, errors.New("hidapi: unknown failure")
-		}
-		failure, _ := wcharTToString(message)
-		return 0, errors.New("hidapi: " + failure)
-	}
+// indexedString retrieves a string descriptor from the device by its index.
+func (h *hidapiHandle) indexedString(index int) (string, error) {
+	return h.getString(func(buffer *C.wchar_t, size C.size_t) (C.int, error) {
+		res, err := C.hid_get_indexed_string(h.device, C.int(index), buffer, size)
+		return res, err
+	})
+}
+
+// getString retrieves a string from the device via one of hidapi's string getter
+// methods, handling the buffer allocation and error checking.
+func (h *hidapiHandle) getString(getter func(buffer *C.wchar_t, size C.size_t) (C.int, error)) (string, error) {
+	// Retrieve the string into a maximally sized buffer
+	buffer := make([]C.wchar_t, maxStringLength)
 
-	return read, nil
+	if res, err := getter(&buffer[0], C.size_t(len(buffer))); res == -1 {
+		return "", h.failure("get_string", err)
+	}
+	return wcharTNToString(&buffer[0], C.size_t(len(buffer)))
 }
@@ -0,0 +1,32 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+//go:build (freebsd && cgo) || (linux && cgo) || (darwin && !ios && cgo) || (windows && cgo)
+// +build freebsd,cgo linux,cgo darwin,!ios,cgo windows,cgo
+
+package hid
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tests that the native library refuses to be torn down while devices are still
+// open, as closing them afterwards would access freed memory.
+func TestExitWithOpenDevices(t *testing.T) {
+	enumerateLock.Lock()
+	openHandles++
+	enumerateLock.Unlock()
+
+	err := Exit()
+
+	enumerateLock.Lock()
+	openHandles--
+	enumerateLock.Unlock()
+
+	if err == nil || !strings.Contains(err.Error(), "1 devices still open") {
+		t.Errorf("exit error mismatch: have %v, want open devices error", err)
+	}
+}
@@ -0,0 +1,55 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+//go:build linux && !cgo
+// +build linux,!cgo
+
+package hid
+
+// nativeSupported returns whether the native HID backend is supported on this
+// platform or not.
+func nativeSupported() bool {
+	return true
+}
+
+// Init initializes the native HID library. Without CGO, devices are accessed via
+// the kernel's hidraw interface directly, so the function is a noop.
+func Init() error {
+	return nil
+}
+
+// Exit releases all the resources held by the native HID library. Without CGO,
+// there is no native library and the function is a noop.
+func Exit() error {
+	return nil
+}
+
+// Version returns the version of the native HID library. Without CGO, there is
+// no native library and the zero version is returned.
+func Version() LibraryVersion {
+	return LibraryVersion{}
+}
+
+// nativeEnumerate returns a list of all the HID devices attached to the system
+// which match the vendor and product id, zero matching any.
+func nativeEnumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
+	return hidrawEnumerate(hidrawClass, hidrawDev, vendorID, productID)
+}
+
+// nativeOpen connects to a previsouly discovered HID device.
+func nativeOpen(info DeviceInfo) (Device, error) {
+	handle, err := openHidraw(hidrawClass, info.Path)
+	if err != nil {
+		return nil, err
+	}
+	return newDevice(info, handle), nil
+}
+
+// nativeOpenMatching connects to the first HID device matching the vendor id,
+// product id and serial number. Without CGO there's no lookup by identifiers, so
+// the hidraw devices are enumerated and matched one by one.
+func nativeOpenMatching(vendorID uint16, productID uint16, serial string) (Device, error) {
+	return openMatching(nativeBackend{}, vendorID, productID, serial)
+}
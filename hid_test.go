@@ -8,12 +8,16 @@ package hid
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 )
 
 // TestThreadedEnumerate Tests that HID enumeration can be called concurrently from multiple threads.
 func TestThreadedEnumerate(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skipf("HID library unavailable: %v", err)
+	}
 	var (
 		threads         = 8
 		errs    []error = make([]error, threads)
@@ -39,3 +43,28 @@ func TestThreadedEnumerate(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the reported library version is consistent between its numeric and
+// textual representation.
+func TestVersion(t *testing.T) {
+	version := Version()
+	if version.Text == "" {
+		t.Skip("no native HID library")
+	}
+	if want := fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch); !strings.HasPrefix(version.String(), want) {
+		t.Errorf("version mismatch: have %s, want %s", version, want)
+	}
+}
+
+// Tests that the library can be torn down and reinitialized.
+func TestInitExit(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skipf("HID library unavailable: %v", err)
+	}
+	if err := Exit(); err != nil {
+		t.Fatalf("failed to exit library: %v", err)
+	}
+	if _, err := Enumerate(0, 0); err != nil {
+		t.Fatalf("failed to enumerate after exit: %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+//go:build mips || mipsle || mips64 || mips64le || ppc64 || ppc64le
+// +build mips mipsle mips64 mips64le ppc64 ppc64le
+
+package hid
+
+// Legacy ioctl request number layout, used by the MIPS and PowerPC architectures.
+const (
+	iocWrite    = 4  // Userspace is writing the ioctl argument
+	iocRead     = 2  // Userspace is reading the ioctl argument
+	iocSizeBits = 13 // Number of bits encoding the argument size
+)
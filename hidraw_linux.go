@@ -0,0 +1,386 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/karalabe/hid/descriptor"
+)
+
+const (
+	hidrawClass = "/sys/class/hidraw" // Sysfs directory listing the hidraw devices
+	hidrawDev   = "/dev"              // Directory containing the hidraw device nodes
+)
+
+// hidrawMaxDescriptorSize is the maximum report descriptor size supported by the
+// hidraw interface (HID_MAX_DESCRIPTOR_SIZE in the kernel).
+const hidrawMaxDescriptorSize = 4096
+
+// Bus types as reported by the kernel in the HID_ID uevent field.
+const (
+	linuxBusUSB       = 0x03
+	linuxBusBluetooth = 0x05
+	linuxBusI2C       = 0x18
+	linuxBusSPI       = 0x1c
+)
+
+// Ioctl request numbers of the hidraw interface, see linux/hidraw.h.
+var (
+	hidiocgrdescsize = ioc(iocRead, 0x01, 4)
+	hidiocgrdesc     = ioc(iocRead, 0x02, 4+hidrawMaxDescriptorSize)
+)
+
+func hidiocsfeature(size int) uintptr { return ioc(iocRead|iocWrite, 0x06, uintptr(size)) }
+func hidiocgfeature(size int) uintptr { return ioc(iocRead|iocWrite, 0x07, uintptr(size)) }
+func hidiocginput(size int) uintptr   { return ioc(iocRead|iocWrite, 0x0a, uintptr(size)) }
+
+// ioc assembles a hidraw ioctl request number from its direction, command number
+// and argument size.
+func ioc(dir uintptr, nr uintptr, size uintptr) uintptr {
+	return dir<<(16+iocSizeBits) | size<<16 | uintptr('H')<<8 | nr
+}
+
+// hidrawEnumerate returns a list of all the hidraw devices listed in the sysfs
+// class directory which match the vendor and product id, zero matching any.
+func hidrawEnumerate(class string, dev string, vendorID uint16, productID uint16) ([]DeviceInfo, error) {
+	entries, err := os.ReadDir(class)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // hidraw not loaded, no devices available
+		}
+		return nil, err
+	}
+	var infos []DeviceInfo
+	for _, entry := range entries {
+		info, err := hidrawDeviceInfo(class, dev, entry.Name())
+		if err != nil {
+			continue // Device detached mid-enumeration, or not a HID device
+		}
+		if (vendorID == 0 || info.VendorID == vendorID) && (productID == 0 || info.ProductID == productID) {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// hidrawDeviceInfo assembles the details of a single hidraw device from sysfs.
+//
+// The identifiers and bus come from the uevent of the HID device. For USB devices
+// the strings, release and interface number are taken from the parent USB device
+// and interface, same as hidapi does. The usage page and usage are those of the
+// first top level collection of the report descriptor.
+func hidrawDeviceInfo(class string, dev string, name string) (DeviceInfo, error) {
+	hiddev, err := filepath.EvalSymlinks(filepath.Join(class, name, "device"))
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	uevent, err := readUevent(filepath.Join(hiddev, "uevent"))
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	var bus, vendorID, productID uint32
+	if _, err := fmt.Sscanf(uevent["HID_ID"], "%x:%x:%x", &bus, &vendorID, &productID); err != nil {
+		return DeviceInfo{}, fmt.Errorf("invalid HID_ID %q: %v", uevent["HID_ID"], err)
+	}
+	info := DeviceInfo{
+		Path:      filepath.Join(dev, name),
+		VendorID:  uint16(vendorID),
+		ProductID: uint16(productID),
+		Serial:    uevent["HID_UNIQ"],
+		Product:   uevent["HID_NAME"],
+		Interface: -1,
+		BusType:   hidrawBusType(bus),
+	}
+	if bus == linuxBusUSB {
+		if iface := sysfsParent(hiddev, "bInterfaceNumber"); iface != "" {
+			if number, err := strconv.ParseUint(readSysfs(iface, "bInterfaceNumber"), 16, 8); err == nil {
+				info.Interface = int(number)
+			}
+			if usb := sysfsParent(iface, "idVendor"); usb != "" {
+				if release, err := strconv.ParseUint(readSysfs(usb, "bcdDevice"), 16, 16); err == nil {
+					info.Release = uint16(release)
+				}
+				info.Manufacturer = readSysfs(usb, "manufacturer")
+				if product := readSysfs(usb, "product"); product != "" {
+					info.Product = product
+				}
+				if info.Serial == "" {
+					info.Serial = readSysfs(usb, "serial")
+				}
+			}
+		}
+	}
+	if blob, err := os.ReadFile(filepath.Join(hiddev, "report_descriptor")); err == nil {
+		if desc, err := descriptor.Parse(blob); err == nil && len(desc.Collections) > 0 {
+			info.UsagePage = desc.Collections[0].Usage.Page()
+			info.Usage = desc.Collections[0].Usage.ID()
+		}
+	}
+	return info, nil
+}
+
+// hidrawBusType converts a kernel bus type into its hid counterpart.
+func hidrawBusType(bus uint32) BusType {
+	switch bus {
+	case linuxBusUSB:
+		return BusUSB
+	case linuxBusBluetooth:
+		return BusBluetooth
+	case linuxBusI2C:
+		return BusI2C
+	case linuxBusSPI:
+		return BusSPI
+	default:
+		return BusUnknown
+	}
+}
+
+// readUevent parses a sysfs uevent file into its key-value pairs.
+func readUevent(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "="); ok {
+			fields[key] = value
+		}
+	}
+	return fields, scanner.Err()
+}
+
+// readSysfs reads a sysfs attribute of a device, returning an empty string if
+// it's not available.
+func readSysfs(dir string, attr string) string {
+	blob, err := os.ReadFile(filepath.Join(dir, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(blob))
+}
+
+// sysfsParent walks up the sysfs device tree from dir, returning the first parent
+// device which has the given attribute, or an empty string if none does.
+func sysfsParent(dir string, attr string) string {
+	for dir = filepath.Dir(dir); filepath.Base(dir) != "devices" && filepath.Dir(dir) != dir; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, attr)); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// hidrawHandle is a live HID device handle, backed by a Linux hidraw device node.
+// Its lifetime is managed by the device wrapping it.
+type hidrawHandle struct {
+	file  *os.File        // Open hidraw device node
+	conn  syscall.RawConn // Raw access to the file descriptor for ioctls
+	class string          // Sysfs class directory, for retrieving the device details
+	path  string          // Path of the hidraw device node, as opened
+	node  string          // Path of the hidraw device node, symlinks resolved
+}
+
+// openHidraw opens a hidraw device node for reading and writing. The path may be
+// a symlink to the node (e.g. a udev alias), which is resolved to find the device
+// details in sysfs.
+func openHidraw(class string, path string) (*hidrawHandle, error) {
+	node, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, hidrawError("open", path, err)
+	}
+	file, err := os.OpenFile(node, os.O_RDWR, 0)
+	if err != nil {
+		return nil, hidrawError("open", path, err)
+	}
+	conn, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, hidrawError("open", path, err)
+	}
+	return &hidrawHandle{file: file, conn: conn, class: class, path: path, node: node}, nil
+}
+
+// hidrawError assembles the error of a failed hidraw operation.
+func hidrawError(op string, path string, err error) error {
+	failure := &Error{Op: op, Path: path}
+
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+		failure.Errno = errno
+		if errno == syscall.EIO {
+			failure.Msg = "device disconnected" // hidraw fails reads with EIO after unplugging
+		}
+	case err == io.EOF:
+		failure.Msg = "device disconnected"
+	default:
+		failure.Msg = err.Error()
+	}
+	return failure
+}
+
+// ioctl executes an ioctl request on the hidraw device node.
+func (h *hidrawHandle) ioctl(op string, req uintptr, arg unsafe.Pointer) (int, error) {
+	var (
+		res   uintptr
+		errno syscall.Errno
+	)
+	if err := h.conn.Control(func(fd uintptr) {
+		res, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	}); err != nil {
+		return 0, hidrawError(op, h.path, err)
+	}
+	if errno != 0 {
+		return 0, hidrawError(op, h.path, errno)
+	}
+	return int(res), nil
+}
+
+// close releases the hidraw device node.
+func (h *hidrawHandle) close() error {
+	return h.file.Close()
+}
+
+// write sends an output report to the device.
+func (h *hidrawHandle) write(b []byte) (int, error) {
+	written, err := h.file.Write(b)
+	if err != nil {
+		return written, hidrawError("write", h.path, err)
+	}
+	return written, nil
+}
+
+// readTimeout retrieves an input report from the device, waiting at most timeout
+// milliseconds for one to arrive, or indefinitely if negative.
+func (h *hidrawHandle) readTimeout(b []byte, timeout int) (int, error) {
+	// A zero timeout is a single non-blocking read, bypass the runtime poller
+	if timeout == 0 {
+		if err := h.file.SetReadDeadline(time.Time{}); err != nil {
+			return 0, hidrawError("read", h.path, err)
+		}
+		var (
+			read  int
+			errno error
+		)
+		err := h.conn.Read(func(fd uintptr) bool {
+			read, errno = syscall.Read(int(fd), b)
+			return true
+		})
+		if err == nil {
+			err = errno
+		}
+		switch {
+		case err == syscall.EAGAIN:
+			return 0, nil
+		case err != nil:
+			return 0, hidrawError("read", h.path, err)
+		case read == 0:
+			return 0, hidrawError("read", h.path, io.EOF)
+		}
+		return read, nil
+	}
+	// Otherwise wait for data via the runtime poller, up to the timeout
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(time.Duration(timeout) * time.Millisecond)
+	}
+	if err := h.file.SetReadDeadline(deadline); err != nil {
+		return 0, hidrawError("read", h.path, err)
+	}
+	read, err := h.file.Read(b)
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return 0, nil
+		}
+		return 0, hidrawError("read", h.path, err)
+	}
+	return read, nil
+}
+
+// sendFeatureReport sends a feature report to the device.
+func (h *hidrawHandle) sendFeatureReport(b []byte) (int, error) {
+	return h.ioctl("send_feature", hidiocsfeature(len(b)), unsafe.Pointer(&b[0]))
+}
+
+// getFeatureReport retrieves a feature report from the device.
+func (h *hidrawHandle) getFeatureReport(b []byte) (int, error) {
+	return h.ioctl("get_feature", hidiocgfeature(len(b)), unsafe.Pointer(&b[0]))
+}
+
+// getInputReport retrieves an input report from the device through a control
+// transfer. It requires Linux 5.11 or later.
+func (h *hidrawHandle) getInputReport(b []byte) (int, error) {
+	return h.ioctl("get_input", hidiocginput(len(b)), unsafe.Pointer(&b[0]))
+}
+
+// getReportDescriptor retrieves the raw report descriptor of the device.
+func (h *hidrawHandle) getReportDescriptor() ([]byte, error) {
+	var size int32
+	if _, err := h.ioctl("get_descriptor", hidiocgrdescsize, unsafe.Pointer(&size)); err != nil {
+		return nil, err
+	}
+	if size < 0 || size > hidrawMaxDescriptorSize {
+		return nil, &Error{Op: "get_descriptor", Path: h.path, Msg: fmt.Sprintf("invalid descriptor size %d", size)}
+	}
+	var desc struct {
+		size  uint32
+		value [hidrawMaxDescriptorSize]byte
+	}
+	desc.size = uint32(size)
+	if _, err := h.ioctl("get_descriptor", hidiocgrdesc, unsafe.Pointer(&desc)); err != nil {
+		return nil, err
+	}
+	return append([]byte{}, desc.value[:desc.size]...), nil
+}
+
+// info retrieves the device details from sysfs.
+func (h *hidrawHandle) info() (DeviceInfo, error) {
+	info, err := hidrawDeviceInfo(h.class, filepath.Dir(h.node), filepath.Base(h.node))
+	if err != nil {
+		return DeviceInfo{}, hidrawError("get_info", h.path, err)
+	}
+	info.Path = h.path
+	return info, nil
+}
+
+// manufacturer retrieves the manufacturer string of the device from sysfs.
+func (h *hidrawHandle) manufacturer() (string, error) {
+	info, err := h.info()
+	return info.Manufacturer, err
+}
+
+// product retrieves the product string of the device from sysfs.
+func (h *hidrawHandle) product() (string, error) {
+	info, err := h.info()
+	return info.Product, err
+}
+
+// serialNumber retrieves the serial number string of the device from sysfs.
+func (h *hidrawHandle) serialNumber() (string, error) {
+	info, err := h.info()
+	return info.Serial, err
+}
+
+// indexedString is not supported by hidraw, which gives no access to arbitrary
+// string descriptors.
+func (h *hidrawHandle) indexedString(index int) (string, error) {
+	return "", &Error{Op: "get_string", Path: h.path, Msg: "indexed strings not supported by hidraw", Errno: syscall.ENOSYS}
+}
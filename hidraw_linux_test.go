@@ -0,0 +1,155 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that hidraw devices are enumerated correctly from a sysfs tree, pulling
+// the details from the HID and parent USB devices.
+func TestHidrawEnumerate(t *testing.T) {
+	wallet := DeviceInfo{
+		Path:         "/dev/hidraw0",
+		VendorID:     0x1209,
+		ProductID:    0x5301,
+		Release:      0x0137,
+		Serial:       "SN0042",
+		Manufacturer: "Acme Corp",
+		Product:      "Hardware Wallet",
+		UsagePage:    0xf1d0,
+		Usage:        0x01,
+		Interface:    1,
+		BusType:      BusUSB,
+	}
+	bluetooth := DeviceInfo{
+		Path:      "/dev/hidraw1",
+		VendorID:  0x2c97,
+		ProductID: 0x4015,
+		Serial:    "aa:bb:cc:dd:ee:ff",
+		Product:   "Nano X",
+		UsagePage: 0xffa0,
+		Usage:     0x01,
+		Interface: -1,
+		BusType:   BusBluetooth,
+	}
+	tests := []struct {
+		vendorID  uint16
+		productID uint16
+		want      []DeviceInfo
+	}{
+		{0, 0, []DeviceInfo{wallet, bluetooth}},
+		{0x1209, 0, []DeviceInfo{wallet}},
+		{0x2c97, 0x4015, []DeviceInfo{bluetooth}},
+		{0x2c97, 0x0001, nil},
+	}
+	for i, tt := range tests {
+		infos, err := hidrawEnumerate("testdata/sysfs/class/hidraw", "/dev", tt.vendorID, tt.productID)
+		if err != nil {
+			t.Fatalf("test %d: failed to enumerate: %v", i, err)
+		}
+		if !reflect.DeepEqual(infos, tt.want) {
+			t.Errorf("test %d: devices mismatch: have %+v, want %+v", i, infos, tt.want)
+		}
+	}
+	// Ensure a missing hidraw class is not an error
+	if infos, err := hidrawEnumerate("testdata/sysfs/class/missing", "/dev", 0, 0); infos != nil || err != nil {
+		t.Errorf("missing class mismatch: have %v, %v, want nil, nil", infos, err)
+	}
+}
+
+// Tests that hidraw devices opened through a symlink (e.g. a udev alias) resolve
+// their details from the node the symlink points to.
+func TestHidrawOpenSymlink(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hidraw0"), nil, 0600); err != nil {
+		t.Fatalf("failed to create device node: %v", err)
+	}
+	alias := filepath.Join(dir, "hidraw-wallet")
+	if err := os.Symlink("hidraw0", alias); err != nil {
+		t.Fatalf("failed to create device alias: %v", err)
+	}
+	handle, err := openHidraw("testdata/sysfs/class/hidraw", alias)
+	if err != nil {
+		t.Fatalf("failed to open device: %v", err)
+	}
+	defer handle.close()
+
+	info, err := handle.info()
+	if err != nil {
+		t.Fatalf("failed to retrieve device info: %v", err)
+	}
+	if info.Path != alias || info.Serial != "SN0042" || info.Product != "Hardware Wallet" {
+		t.Errorf("info mismatch: have %+v, want wallet at %s", info, alias)
+	}
+	if product, err := handle.product(); err != nil || product != "Hardware Wallet" {
+		t.Errorf("product mismatch: have %q, %v, want %q", product, err, "Hardware Wallet")
+	}
+}
+
+// Tests that the hidraw ioctl request numbers match the kernel headers.
+func TestHidrawIoctls(t *testing.T) {
+	if iocSizeBits != 14 {
+		t.Skip("legacy ioctl layout")
+	}
+	tests := []struct {
+		have uintptr
+		want uintptr
+	}{
+		{hidiocgrdescsize, 0x80044801},
+		{hidiocgrdesc, 0x90044802},
+		{hidiocsfeature(65), 0xc0414806},
+		{hidiocgfeature(65), 0xc0414807},
+		{hidiocginput(65), 0xc041480a},
+	}
+	for i, tt := range tests {
+		if tt.have != tt.want {
+			t.Errorf("test %d: request mismatch: have %#x, want %#x", i, tt.have, tt.want)
+		}
+	}
+}
+
+// Tests that reads on a hidraw handle honor the timeout and deliver data.
+func TestHidrawReadTimeout(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer writer.Close()
+
+	conn, err := reader.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to access pipe: %v", err)
+	}
+	handle := &hidrawHandle{file: reader, conn: conn, path: "pipe"}
+	defer handle.close()
+
+	buf := make([]byte, 8)
+	for _, timeout := range []int{0, 20} {
+		start := time.Now()
+		if n, err := handle.readTimeout(buf, timeout); n != 0 || err != nil {
+			t.Errorf("timeout %d: result mismatch: have %d, %v, want 0, nil", timeout, n, err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Duration(timeout)*time.Millisecond {
+			t.Errorf("timeout %d: returned early after %v", timeout, elapsed)
+		}
+	}
+	for _, timeout := range []int{0, 20, -1} {
+		writer.Write([]byte{0x01, 0x02, 0x03})
+		if n, err := handle.readTimeout(buf, timeout); n != 3 || err != nil {
+			t.Errorf("timeout %d: result mismatch: have %d, %v, want 3, nil", timeout, n, err)
+		}
+	}
+	writer.Close()
+	if _, err := handle.readTimeout(buf, -1); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("hangup error mismatch: have %v, want %v", err, ErrDisconnected)
+	}
+}
@@ -0,0 +1,507 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+// Package hidtest provides scriptable in-memory HID devices for unit testing code
+// built on top of the hid package, without requiring real hardware.
+//
+// Fake devices are served by a backend registered with the hid package under the
+// name "hidtest", so once attached, they are returned by hid.Enumerate and can be
+// opened via DeviceInfo.Open like any native device.
+package hidtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/karalabe/hid"
+)
+
+// BackendName is the name the fake device backend is registered with in the hid
+// package. Paths of fake devices are namespaced with it.
+const BackendName = "hidtest"
+
+func init() {
+	hid.Register(BackendName, fakes)
+}
+
+// fakes is the backend serving all the attached fake devices.
+var fakes = &backend{devices: make(map[string]*FakeDevice)}
+
+// backend is a hid.Backend serving the attached fake devices.
+type backend struct {
+	devices   map[string]*FakeDevice     // Attached fake devices, keyed by path
+	listeners map[chan struct{}]struct{} // Subscribers to device changes
+	counter   int                        // Counter to assign unique paths with
+	lock      sync.Mutex                 // Lock protecting the fields above
+}
+
+// Enumerate implements hid.Backend, listing the attached fake devices.
+func (b *backend) Enumerate(vendorID uint16, productID uint16) ([]hid.DeviceInfo, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var infos []hid.DeviceInfo
+	for _, dev := range b.devices {
+		if (vendorID == 0 || dev.info.VendorID == vendorID) && (productID == 0 || dev.info.ProductID == productID) {
+			infos = append(infos, dev.info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos, nil
+}
+
+// Open implements hid.Backend, opening an attached fake device.
+func (b *backend) Open(info hid.DeviceInfo) (hid.Device, error) {
+	b.lock.Lock()
+	dev, ok := b.devices[info.Path]
+	b.lock.Unlock()
+
+	if !ok {
+		return nil, &hid.Error{Op: "open", Path: info.Path, Msg: "device not found"}
+	}
+	return &handle{dev: dev}, nil
+}
+
+// Notify implements hid.Notifier, signalling whenever a fake device is attached
+// or detached.
+func (b *backend) Notify(ctx context.Context) (<-chan struct{}, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.listeners == nil {
+		b.listeners = make(map[chan struct{}]struct{})
+	}
+	sink := make(chan struct{}, 1)
+	b.listeners[sink] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		delete(b.listeners, sink)
+		close(sink)
+	}()
+	return sink, nil
+}
+
+// notify signals all the listeners that the set of devices changed. The caller
+// must hold the backend lock.
+func (b *backend) notify() {
+	for sink := range b.listeners {
+		select {
+		case sink <- struct{}{}:
+		default: // Change already signalled, coalesce
+		}
+	}
+}
+
+// FakeDevice is a scriptable in-memory HID device implementing hid.Device. Input
+// reports are queued up by the test, while writes and feature reports sent by the
+// code under test are captured for inspection.
+//
+// The device is usable as a hid.Device handle of its own. Opening it through the
+// hid package returns further handles sharing the device state, but each with its
+// own closed flag and deadlines, like the handles of a real device.
+type FakeDevice struct {
+	*handle // Handle used when the device is accessed directly
+
+	info       hid.DeviceInfo // Details of the device, path assigned when attached
+	descriptor []byte         // Report descriptor returned to the user
+	strings    map[int]string // String descriptors by index
+
+	inputs   [][]byte      // Queued input reports, to be returned by reads
+	wake     chan struct{} // Closed and replaced whenever blocked reads should recheck
+	writes   [][]byte      // Output reports written by the user
+	features [][]byte      // Feature reports sent by the user
+
+	getFeature func(b []byte) (int, error) // Handler answering feature report requests
+	getInput   func(b []byte) (int, error) // Handler answering input report requests
+
+	failure      error // Error to fail the next operation with
+	attached     bool  // Whether the device is visible through the hid package
+	disconnected bool  // Whether the device was unplugged
+
+	lock sync.Mutex // Lock protecting the fields above and those of the handles
+}
+
+// handle is an open connection to a fake device, implementing hid.Device.
+type handle struct {
+	dev    *FakeDevice // Fake device the handle is connected to
+	closed bool        // Whether the handle was closed by the user
+
+	readDeadline  time.Time // Deadline for reads, zero if none
+	writeDeadline time.Time // Deadline for writes, zero if none
+}
+
+// NewFakeDevice creates a fake HID device with the given details and report
+// descriptor. The device is not visible until attached. If the path is empty, a
+// unique one is assigned on attachment.
+func NewFakeDevice(info hid.DeviceInfo, descriptor []byte) *FakeDevice {
+	dev := &FakeDevice{
+		info:       info,
+		descriptor: append([]byte{}, descriptor...),
+		strings:    make(map[int]string),
+		wake:       make(chan struct{}),
+	}
+	dev.handle = &handle{dev: dev}
+	return dev
+}
+
+// Attach plugs the device in, making it visible to hid.Enumerate and openable
+// through the hid package. It returns the namespaced path of the device.
+func (d *FakeDevice) Attach() string {
+	fakes.lock.Lock()
+	defer fakes.lock.Unlock()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.attached {
+		if d.info.Path == "" {
+			fakes.counter++
+			d.info.Path = fmt.Sprintf("fake%d", fakes.counter)
+		}
+		if _, ok := fakes.devices[d.info.Path]; ok {
+			panic("hidtest: duplicate device path " + d.info.Path)
+		}
+		fakes.devices[d.info.Path] = d
+		fakes.notify()
+
+		d.attached, d.disconnected = true, false
+	}
+	return BackendName + ":" + d.info.Path
+}
+
+// Disconnect unplugs the device, removing it from the enumeration. Pending and
+// future operations on the device fail with an error matching hid.ErrDisconnected.
+func (d *FakeDevice) Disconnect() {
+	fakes.lock.Lock()
+	defer fakes.lock.Unlock()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.attached {
+		delete(fakes.devices, d.info.Path)
+		fakes.notify()
+	}
+	d.attached, d.disconnected = false, true
+	d.signal()
+}
+
+// QueueInput queues up an input report to be returned by a subsequent read.
+func (d *FakeDevice) QueueInput(report []byte) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.inputs = append(d.inputs, append([]byte{}, report...))
+	d.signal()
+}
+
+// Writes returns all the output reports written to the device so far.
+func (d *FakeDevice) Writes() [][]byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return append([][]byte{}, d.writes...)
+}
+
+// FeatureReports returns all the feature reports sent to the device so far.
+func (d *FakeDevice) FeatureReports() [][]byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return append([][]byte{}, d.features...)
+}
+
+// HandleGetFeature sets the handler answering feature report requests. It gets
+// the buffer of the request, with the report id in the first byte, and returns
+// the number of bytes filled in. Without a handler, requests fail.
+func (d *FakeDevice) HandleGetFeature(handler func(b []byte) (int, error)) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.getFeature = handler
+}
+
+// HandleGetInput sets the handler answering input report requests made through
+// GetInputReport, with the same semantics as HandleGetFeature.
+func (d *FakeDevice) HandleGetInput(handler func(b []byte) (int, error)) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.getInput = handler
+}
+
+// SetString sets the string descriptor returned for an index by IndexedString.
+func (d *FakeDevice) SetString(index int, str string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.strings[index] = str
+}
+
+// InjectError makes the next operation on the device fail with err. A blocked
+// read is failed immediately.
+func (d *FakeDevice) InjectError(err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.failure = err
+	d.signal()
+}
+
+// signal wakes up all blocked readers to recheck the device state. The caller
+// must hold the device lock.
+func (d *FakeDevice) signal() {
+	close(d.wake)
+	d.wake = make(chan struct{})
+}
+
+// check returns the error the next operation should fail with, if any, consuming
+// an injected failure. The caller must hold the device lock.
+func (h *handle) check(op string) error {
+	d := h.dev
+	switch {
+	case h.closed:
+		return hid.ErrDeviceClosed
+	case d.disconnected:
+		return &hid.Error{Op: op, Path: BackendName + ":" + h.dev.info.Path, Msg: "device disconnected"}
+	case d.failure != nil:
+		err := d.failure
+		d.failure = nil
+		return err
+	}
+	return nil
+}
+
+// Close implements hid.Device, closing the handle. Blocked reads on it are
+// interrupted and return hid.ErrDeviceClosed, other handles are unaffected.
+func (h *handle) Close() error {
+	h.dev.lock.Lock()
+	defer h.dev.lock.Unlock()
+
+	h.closed = true
+	h.dev.signal()
+	return nil
+}
+
+// Write implements hid.Device, capturing an output report.
+func (h *handle) Write(b []byte) (int, error) {
+	return h.WriteContext(context.Background(), b)
+}
+
+// WriteContext implements hid.Device, capturing an output report.
+func (h *handle) WriteContext(ctx context.Context, b []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	h.dev.lock.Lock()
+	defer h.dev.lock.Unlock()
+
+	if err := h.check("write"); err != nil {
+		return 0, err
+	}
+	if !h.writeDeadline.IsZero() && !time.Now().Before(h.writeDeadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	h.dev.writes = append(h.dev.writes, append([]byte{}, b...))
+	return len(b), nil
+}
+
+// Read implements hid.Device, returning the next queued input report.
+func (h *handle) Read(b []byte) (int, error) {
+	return h.read(context.Background(), b, -1)
+}
+
+// ReadTimeout implements hid.Device, returning the next queued input report. If
+// timeout is -1, a blocking read is performed.
+func (h *handle) ReadTimeout(b []byte, timeout int) (int, error) {
+	if timeout < 0 {
+		return h.read(context.Background(), b, -1)
+	}
+	return h.read(context.Background(), b, time.Duration(timeout)*time.Millisecond)
+}
+
+// ReadContext implements hid.Device, returning the next queued input report.
+func (h *handle) ReadContext(ctx context.Context, b []byte) (int, error) {
+	return h.read(ctx, b, -1)
+}
+
+// read waits for a queued input report until the context is cancelled, the read
+// deadline passes or the timeout elapses. A negative timeout means no timeout.
+func (h *handle) read(ctx context.Context, b []byte, timeout time.Duration) (int, error) {
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		expired = timer.C
+	}
+	for {
+		h.dev.lock.Lock()
+		if err := h.check("read"); err != nil {
+			h.dev.lock.Unlock()
+			return 0, err
+		}
+		if len(h.dev.inputs) > 0 {
+			report := h.dev.inputs[0]
+			h.dev.inputs = h.dev.inputs[1:]
+			h.dev.lock.Unlock()
+
+			return copy(b, report), nil
+		}
+		wake, deadline := h.dev.wake, h.readDeadline
+		h.dev.lock.Unlock()
+
+		var passed <-chan time.Time
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			passed = time.After(left)
+		}
+		select {
+		case <-wake:
+			// Device state changed, recheck
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-passed:
+			return 0, os.ErrDeadlineExceeded
+		case <-expired:
+			return 0, nil
+		}
+	}
+}
+
+// SetDeadline implements hid.Device, setting both the read and write deadlines.
+func (h *handle) SetDeadline(t time.Time) error {
+	h.dev.lock.Lock()
+	defer h.dev.lock.Unlock()
+
+	h.readDeadline, h.writeDeadline = t, t
+	h.dev.signal()
+	return nil
+}
+
+// SetReadDeadline implements hid.Device, setting the read deadline.
+func (h *handle) SetReadDeadline(t time.Time) error {
+	h.dev.lock.Lock()
+	defer h.dev.lock.Unlock()
+
+	h.readDeadline = t
+	h.dev.signal()
+	return nil
+}
+
+// SetWriteDeadline implements hid.Device, setting the write deadline.
+func (h *handle) SetWriteDeadline(t time.Time) error {
+	h.dev.lock.Lock()
+	defer h.dev.lock.Unlock()
+
+	h.writeDeadline = t
+	return nil
+}
+
+// SendFeatureReport implements hid.Device, capturing a feature report.
+func (h *handle) SendFeatureReport(b []byte) (int, error) {
+	h.dev.lock.Lock()
+	defer h.dev.lock.Unlock()
+
+	if err := h.check("send_feature"); err != nil {
+		return 0, err
+	}
+	h.dev.features = append(h.dev.features, append([]byte{}, b...))
+	return len(b), nil
+}
+
+// GetFeatureReport implements hid.Device, answering via the feature handler.
+func (h *handle) GetFeatureReport(b []byte) (int, error) {
+	return h.request("get_feature", b, func() func([]byte) (int, error) { return h.dev.getFeature })
+}
+
+// GetInputReport implements hid.Device, answering via the input handler.
+func (h *handle) GetInputReport(b []byte) (int, error) {
+	return h.request("get_input", b, func() func([]byte) (int, error) { return h.dev.getInput })
+}
+
+// request answers a report request via the handler set for it. The handler is
+// called without holding the lock, so it may freely script the device.
+func (h *handle) request(op string, b []byte, handler func() func([]byte) (int, error)) (int, error) {
+	h.dev.lock.Lock()
+	if err := h.check(op); err != nil {
+		h.dev.lock.Unlock()
+		return 0, err
+	}
+	answer := handler()
+	h.dev.lock.Unlock()
+
+	if answer == nil {
+		return 0, &hid.Error{Op: op, Path: BackendName + ":" + h.dev.info.Path, Msg: "no handler set"}
+	}
+	return answer(b)
+}
+
+// GetReportDescriptor implements hid.Device, returning the configured descriptor.
+func (h *handle) GetReportDescriptor() ([]byte, error) {
+	h.dev.lock.Lock()
+	defer h.dev.lock.Unlock()
+
+	if err := h.check("get_descriptor"); err != nil {
+		return nil, err
+	}
+	return append([]byte{}, h.dev.descriptor...), nil
+}
+
+// Info implements hid.Device, returning the configured device details.
+func (h *handle) Info() (hid.DeviceInfo, error) {
+	h.dev.lock.Lock()
+	defer h.dev.lock.Unlock()
+
+	if err := h.check("get_info"); err != nil {
+		return hid.DeviceInfo{}, err
+	}
+	return h.dev.info, nil
+}
+
+// Manufacturer implements hid.Device, returning the configured manufacturer.
+func (h *handle) Manufacturer() (string, error) {
+	info, err := h.Info()
+	return info.Manufacturer, err
+}
+
+// Product implements hid.Device, returning the configured product.
+func (h *handle) Product() (string, error) {
+	info, err := h.Info()
+	return info.Product, err
+}
+
+// SerialNumber implements hid.Device, returning the configured serial number.
+func (h *handle) SerialNumber() (string, error) {
+	info, err := h.Info()
+	return info.Serial, err
+}
+
+// IndexedString implements hid.Device, returning a string set via SetString.
+func (h *handle) IndexedString(index int) (string, error) {
+	h.dev.lock.Lock()
+	defer h.dev.lock.Unlock()
+
+	if err := h.check("get_string"); err != nil {
+		return "", err
+	}
+	str, ok := h.dev.strings[index]
+	if !ok {
+		return "", &hid.Error{Op: "get_string", Path: BackendName + ":" + h.dev.info.Path, Msg: fmt.Sprintf("no string descriptor at index %d", index)}
+	}
+	return str, nil
+}
@@ -0,0 +1,206 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hidtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/karalabe/hid"
+)
+
+// fido is a minimal FIDO HID report descriptor with 64 byte input and output
+// reports.
+var fido = []byte{
+	0x06, 0xd0, 0xf1, 0x09, 0x01, 0xa1, 0x01, 0x09, 0x20, 0x15, 0x00, 0x26, 0xff, 0x00, 0x75, 0x08,
+	0x95, 0x40, 0x81, 0x02, 0x09, 0x21, 0x15, 0x00, 0x26, 0xff, 0x00, 0x75, 0x08, 0x95, 0x40, 0x91,
+	0x02, 0xc0,
+}
+
+// Tests that attached fake devices are found and opened through the hid package,
+// and that they can be scripted end to end.
+func TestFakeDevice(t *testing.T) {
+	fake := NewFakeDevice(hid.DeviceInfo{VendorID: 0x1209, ProductID: 0xf1d0, Serial: "FAKE01", Product: "Key"}, fido)
+	path := fake.Attach()
+	defer fake.Disconnect()
+
+	// The native backend may be unavailable, the fakes are listed regardless
+	infos, _ := hid.EnumerateFilter(hid.Filter{VendorID: 0x1209, Serial: "FAKE01"})
+	if len(infos) != 1 || infos[0].Path != path {
+		t.Fatalf("enumeration mismatch: have %v, want single device at %s", infos, path)
+	}
+	dev, err := hid.Open(0x1209, 0xf1d0, "FAKE01")
+	if err != nil {
+		t.Fatalf("failed to open device: %v", err)
+	}
+	defer dev.Close()
+
+	if info, err := dev.Info(); err != nil || info.Path != path {
+		t.Errorf("info mismatch: have %v, %v, want path %s", info.Path, err, path)
+	}
+	if desc, err := dev.GetReportDescriptor(); err != nil || !bytes.Equal(desc, fido) {
+		t.Errorf("descriptor mismatch: have %x, %v, want %x", desc, err, fido)
+	}
+	// Exchange some reports with the device
+	fake.QueueInput([]byte{0x01, 0x02, 0x03})
+
+	buf := make([]byte, 64)
+	if n, err := dev.Read(buf); err != nil || !bytes.Equal(buf[:n], []byte{0x01, 0x02, 0x03}) {
+		t.Errorf("read mismatch: have %x, %v, want %x", buf[:n], err, []byte{0x01, 0x02, 0x03})
+	}
+	if n, err := dev.ReadTimeout(buf, 10); n != 0 || err != nil {
+		t.Errorf("empty read mismatch: have %d, %v, want 0, nil", n, err)
+	}
+	dev.Write([]byte{0x00, 0xaa})
+	dev.SendFeatureReport([]byte{0x05, 0xbb})
+
+	if have, want := fake.Writes(), [][]byte{{0x00, 0xaa}}; !reflect.DeepEqual(have, want) {
+		t.Errorf("writes mismatch: have %x, want %x", have, want)
+	}
+	if have, want := fake.FeatureReports(), [][]byte{{0x05, 0xbb}}; !reflect.DeepEqual(have, want) {
+		t.Errorf("feature reports mismatch: have %x, want %x", have, want)
+	}
+	fake.HandleGetFeature(func(b []byte) (int, error) {
+		return copy(b, []byte{b[0], 0xcc}), nil
+	})
+	feature := []byte{0x07, 0x00, 0x00}
+	if n, err := dev.GetFeatureReport(feature); err != nil || !bytes.Equal(feature[:n], []byte{0x07, 0xcc}) {
+		t.Errorf("feature mismatch: have %x, %v, want %x", feature[:n], err, []byte{0x07, 0xcc})
+	}
+	// Ensure injected errors fail only the next operation
+	failure := errors.New("injected")
+	fake.InjectError(failure)
+	if _, err := dev.Write([]byte{0x00}); err != failure {
+		t.Errorf("injected error mismatch: have %v, want %v", err, failure)
+	}
+	if _, err := dev.Write([]byte{0x00}); err != nil {
+		t.Errorf("write after injected error failed: %v", err)
+	}
+}
+
+// Tests that disconnecting a fake device unblocks readers, fails subsequent calls
+// and removes it from the enumeration.
+func TestFakeDeviceDisconnect(t *testing.T) {
+	fake := NewFakeDevice(hid.DeviceInfo{VendorID: 0x1209, ProductID: 0xd15c}, fido)
+	path := fake.Attach()
+
+	dev, err := hid.DeviceInfo{Path: path}.Open()
+	if err != nil {
+		t.Fatalf("failed to open device: %v", err)
+	}
+	errc := make(chan error)
+	go func() {
+		_, err := dev.ReadContext(context.Background(), make([]byte, 64))
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	fake.Disconnect()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, hid.ErrDisconnected) {
+			t.Errorf("read error mismatch: have %v, want %v", err, hid.ErrDisconnected)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("read not unblocked by disconnect")
+	}
+	if _, err := dev.Write([]byte{0x00}); !errors.Is(err, hid.ErrDisconnected) {
+		t.Errorf("write error mismatch: have %v, want %v", err, hid.ErrDisconnected)
+	}
+	if infos, _ := hid.Enumerate(0x1209, 0xd15c); len(infos) != 0 {
+		t.Errorf("disconnected device still enumerated: %v", infos)
+	}
+}
+
+// Tests that read deadlines interrupt reads on fake devices.
+func TestFakeDeviceDeadline(t *testing.T) {
+	fake := NewFakeDevice(hid.DeviceInfo{}, fido)
+
+	fake.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := fake.Read(make([]byte, 64)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("deadline error mismatch: have %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+}
+
+// Tests that every open returns an independent handle, which can be closed and
+// given deadlines without affecting the other handles of the same device.
+func TestFakeDeviceHandles(t *testing.T) {
+	fake := NewFakeDevice(hid.DeviceInfo{VendorID: 0x1209, ProductID: 0x4a9d}, fido)
+	path := fake.Attach()
+	defer fake.Disconnect()
+
+	first, err := hid.DeviceInfo{Path: path}.Open()
+	if err != nil {
+		t.Fatalf("failed to open first handle: %v", err)
+	}
+	second, err := hid.DeviceInfo{Path: path}.Open()
+	if err != nil {
+		t.Fatalf("failed to open second handle: %v", err)
+	}
+	defer second.Close()
+
+	first.SetReadDeadline(time.Now().Add(-time.Second))
+	if err := first.Close(); err != nil {
+		t.Fatalf("failed to close first handle: %v", err)
+	}
+	if _, err := first.Write([]byte{0x00}); err != hid.ErrDeviceClosed {
+		t.Errorf("closed write error mismatch: have %v, want %v", err, hid.ErrDeviceClosed)
+	}
+	if _, err := second.Write([]byte{0x00, 0x01}); err != nil {
+		t.Errorf("write via open handle failed: %v", err)
+	}
+	fake.QueueInput([]byte{0x02})
+	if n, err := second.ReadTimeout(make([]byte, 64), 100); n != 1 || err != nil {
+		t.Errorf("read via open handle mismatch: have %d, %v, want 1, nil", n, err)
+	}
+	// Reopening after a close gets a fresh handle, the direct one is also separate
+	third, err := hid.DeviceInfo{Path: path}.Open()
+	if err != nil {
+		t.Fatalf("failed to reopen device: %v", err)
+	}
+	defer third.Close()
+
+	if _, err := third.Write([]byte{0x00, 0x02}); err != nil {
+		t.Errorf("write via reopened handle failed: %v", err)
+	}
+	fake.Close()
+	if _, err := second.Write([]byte{0x00, 0x03}); err != nil {
+		t.Errorf("write after closing direct handle failed: %v", err)
+	}
+	if have := len(fake.Writes()); have != 3 {
+		t.Errorf("write count mismatch: have %d, want 3", have)
+	}
+}
+
+// Tests that fake devices coming and going are reported by hid.Watch.
+func TestFakeDeviceWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := hid.Watch(ctx, hid.Filter{VendorID: 0x1209, ProductID: 0x3a7c})
+	if err != nil {
+		t.Fatalf("failed to start watching: %v", err)
+	}
+	fake := NewFakeDevice(hid.DeviceInfo{VendorID: 0x1209, ProductID: 0x3a7c}, fido)
+	path := fake.Attach()
+
+	for _, want := range []hid.EventType{hid.Arrived, hid.Removed} {
+		select {
+		case event := <-events:
+			if event.Type != want || event.Info.Path != path {
+				t.Fatalf("event mismatch: have %v %s, want %v %s", event.Type, event.Info.Path, want, path)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("timeout waiting for %v event", want)
+		}
+		fake.Disconnect()
+	}
+}
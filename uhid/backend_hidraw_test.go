@@ -0,0 +1,14 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+//go:build linux && (!cgo || hidraw)
+// +build linux
+// +build !cgo hidraw
+
+package uhid
+
+// enumerable is whether the native backend of the hid package sees uhid devices,
+// which only the hidraw based ones do.
+const enumerable = true
@@ -0,0 +1,84 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+// Package uhid creates virtual HID devices through the Linux /dev/uhid interface.
+//
+// Virtual devices are handled by the kernel's HID stack just like physical ones,
+// showing up as hidraw nodes that the hid package can enumerate and open (when
+// using one of its hidraw based backends). This allows end-to-end testing of HID
+// device drivers against the real kernel, within a single process.
+//
+// Accessing /dev/uhid usually requires root privileges.
+package uhid
+
+import (
+	"errors"
+
+	"github.com/karalabe/hid"
+)
+
+// Path is the location of the uhid character device.
+const Path = "/dev/uhid"
+
+// ErrClosed is returned for operations on a virtual device already destroyed.
+var ErrClosed = errors.New("uhid: device closed")
+
+// ReportType is the kind of a HID report exchanged through control transfers.
+type ReportType uint8
+
+// Report types as defined by the uhid interface.
+const (
+	FeatureReport ReportType = 0 // Feature report
+	OutputReport  ReportType = 1 // Output report
+	InputReport   ReportType = 2 // Input report
+)
+
+// String implements fmt.Stringer.
+func (t ReportType) String() string {
+	switch t {
+	case FeatureReport:
+		return "feature"
+	case OutputReport:
+		return "output"
+	case InputReport:
+		return "input"
+	default:
+		return "unknown"
+	}
+}
+
+// Config contains the details of a virtual HID device to create, along with the
+// callbacks answering the requests of the kernel.
+//
+// Callbacks are invoked sequentially from a single background goroutine, and the
+// kernel waits for get and set report requests to be answered, so they should not
+// block for long. Report data includes the report id as its first byte, the same
+// way the hid package exchanges reports.
+//
+// Callbacks must not call Close on the device synchronously, as Close waits for
+// the running callback to return, deadlocking. Use a separate goroutine instead.
+type Config struct {
+	Name       string      // Name of the device, reported as the product on non-USB buses
+	Phys       string      // Physical location of the device (optional)
+	Uniq       string      // Unique identifier of the device, reported as the serial number
+	BusType    hid.BusType // Bus the device pretends to be attached to (default USB)
+	VendorID   uint16      // Device Vendor ID
+	ProductID  uint16      // Device Product ID
+	Version    uint32      // Device release number
+	Country    uint32      // HID country code
+	Descriptor []byte      // HID report descriptor of the device
+
+	// OnOutput is called with every output report written to the device.
+	OnOutput func(report []byte)
+
+	// OnGetReport is called to answer requests for feature or input reports. A
+	// nil callback or a returned error fails the request.
+	OnGetReport func(kind ReportType, id byte) ([]byte, error)
+
+	// OnSetReport is called with feature or output reports sent to the device
+	// through control transfers. A nil callback or a returned error fails the
+	// request.
+	OnSetReport func(kind ReportType, id byte, report []byte) error
+}
@@ -0,0 +1,268 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package uhid
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/karalabe/hid"
+)
+
+// Event types of the uhid interface, see linux/uhid.h.
+const (
+	eventDestroy        = 1
+	eventStart          = 2
+	eventStop           = 3
+	eventOpen           = 4
+	eventClose          = 5
+	eventOutput         = 6
+	eventGetReport      = 9
+	eventGetReportReply = 10
+	eventCreate2        = 11
+	eventInput2         = 12
+	eventSetReport      = 13
+	eventSetReportReply = 14
+)
+
+const (
+	maxDataSize       = 4096 // Maximum size of a report (UHID_DATA_MAX)
+	maxDescriptorSize = 4096 // Maximum size of a report descriptor (HID_MAX_DESCRIPTOR_SIZE)
+
+	// eventSize is the size of struct uhid_event, dominated by the create2 request:
+	// the event type, 256 bytes of strings, 20 bytes of ids and the descriptor.
+	eventSize = 4 + 256 + 20 + maxDescriptorSize
+)
+
+// Bus types as expected by the kernel.
+const (
+	linuxBusUSB       = 0x03
+	linuxBusBluetooth = 0x05
+	linuxBusI2C       = 0x18
+	linuxBusSPI       = 0x1c
+)
+
+// nativeEndian is the byte order of the host, which the uhid structs are laid out in.
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	probe := uint16(1)
+	if *(*byte)(unsafe.Pointer(&probe)) == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// Device is a virtual HID device backed by the kernel's uhid interface.
+type Device struct {
+	config Config   // Details and callbacks of the device
+	file   *os.File // Open handle to /dev/uhid, owning the device
+
+	lock   sync.Mutex    // Lock serializing writes to the uhid handle
+	closed bool          // Whether the device was already destroyed
+	done   chan struct{} // Closed when the event loop terminates
+}
+
+// New creates a virtual HID device, which shows up in the system until closed.
+func New(config Config) (*Device, error) {
+	if len(config.Descriptor) == 0 || len(config.Descriptor) > maxDescriptorSize {
+		return nil, fmt.Errorf("uhid: invalid descriptor size %d", len(config.Descriptor))
+	}
+	file, err := os.OpenFile(Path, os.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	dev := &Device{
+		config: config,
+		file:   file,
+		done:   make(chan struct{}),
+	}
+	if err := dev.write(dev.create()); err != nil {
+		file.Close()
+		return nil, err
+	}
+	go dev.loop()
+	return dev, nil
+}
+
+// create assembles the UHID_CREATE2 event describing the device.
+func (d *Device) create() []byte {
+	event := newEvent(eventCreate2)
+	req := event[4:]
+
+	copy(req[0:127], d.config.Name)
+	copy(req[128:191], d.config.Phys)
+	copy(req[192:255], d.config.Uniq)
+
+	nativeEndian.PutUint16(req[256:], uint16(len(d.config.Descriptor)))
+	nativeEndian.PutUint16(req[258:], linuxBusType(d.config.BusType))
+	nativeEndian.PutUint32(req[260:], uint32(d.config.VendorID))
+	nativeEndian.PutUint32(req[264:], uint32(d.config.ProductID))
+	nativeEndian.PutUint32(req[268:], d.config.Version)
+	nativeEndian.PutUint32(req[272:], d.config.Country)
+	copy(req[276:], d.config.Descriptor)
+
+	return event
+}
+
+// linuxBusType converts a hid bus type into its kernel counterpart, defaulting
+// to USB if unknown.
+func linuxBusType(bus hid.BusType) uint16 {
+	switch bus {
+	case hid.BusBluetooth:
+		return linuxBusBluetooth
+	case hid.BusI2C:
+		return linuxBusI2C
+	case hid.BusSPI:
+		return linuxBusSPI
+	default:
+		return linuxBusUSB
+	}
+}
+
+// newEvent allocates a uhid event of the given type.
+func newEvent(kind uint32) []byte {
+	event := make([]byte, eventSize)
+	nativeEndian.PutUint32(event, kind)
+	return event
+}
+
+// write sends an event to the kernel.
+func (d *Device) write(event []byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	_, err := d.file.Write(event)
+	return err
+}
+
+// Input sends an input report from the virtual device to the kernel, which will
+// deliver it to the readers of the device.
+func (d *Device) Input(report []byte) error {
+	if len(report) > maxDataSize {
+		return fmt.Errorf("uhid: report too large: %d > %d", len(report), maxDataSize)
+	}
+	event := newEvent(eventInput2)
+	nativeEndian.PutUint16(event[4:], uint16(len(report)))
+	copy(event[6:], report)
+
+	return d.write(event)
+}
+
+// Close destroys the virtual device, removing it from the system. It waits for
+// any running callback to return, so no callbacks are invoked after it returns,
+// which also means it must not be called from within a callback.
+func (d *Device) Close() error {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return nil
+	}
+	_, err := d.file.Write(newEvent(eventDestroy))
+	d.closed = true
+	d.lock.Unlock()
+
+	if cerr := d.file.Close(); err == nil {
+		err = cerr
+	}
+	<-d.done
+	return err
+}
+
+// loop reads the events sent by the kernel and dispatches them to the callbacks,
+// until the device is closed.
+func (d *Device) loop() {
+	defer close(d.done)
+
+	event := make([]byte, eventSize)
+	for {
+		n, err := d.file.Read(event)
+		if err != nil {
+			return
+		}
+		if n < 4 {
+			continue
+		}
+		req := event[4:n]
+
+		switch nativeEndian.Uint32(event) {
+		case eventOutput:
+			if len(req) < maxDataSize+3 {
+				continue
+			}
+			size := int(nativeEndian.Uint16(req[maxDataSize:]))
+			if size > maxDataSize {
+				continue
+			}
+			if d.config.OnOutput != nil {
+				d.config.OnOutput(append([]byte{}, req[:size]...))
+			}
+
+		case eventGetReport:
+			if len(req) < 6 {
+				continue
+			}
+			id, rnum, kind := nativeEndian.Uint32(req), req[4], ReportType(req[5])
+
+			var (
+				report []byte
+				err    error = errors.New("no handler")
+			)
+			if d.config.OnGetReport != nil {
+				report, err = d.config.OnGetReport(kind, rnum)
+			}
+			reply := newEvent(eventGetReportReply)
+			nativeEndian.PutUint32(reply[4:], id)
+			if err == nil && len(report) > maxDataSize {
+				err = syscall.EMSGSIZE
+			}
+			if err != nil {
+				nativeEndian.PutUint16(reply[8:], errnoOf(err))
+			} else {
+				nativeEndian.PutUint16(reply[10:], uint16(len(report)))
+				copy(reply[12:], report)
+			}
+			d.write(reply)
+
+		case eventSetReport:
+			if len(req) < 8 {
+				continue
+			}
+			id, rnum, kind := nativeEndian.Uint32(req), req[4], ReportType(req[5])
+			size := int(nativeEndian.Uint16(req[6:]))
+			if size > len(req)-8 {
+				size = len(req) - 8
+			}
+			err := errors.New("no handler")
+			if d.config.OnSetReport != nil {
+				err = d.config.OnSetReport(kind, rnum, append([]byte{}, req[8:8+size]...))
+			}
+			reply := newEvent(eventSetReportReply)
+			nativeEndian.PutUint32(reply[4:], id)
+			if err != nil {
+				nativeEndian.PutUint16(reply[8:], errnoOf(err))
+			}
+			d.write(reply)
+		}
+	}
+}
+
+// errnoOf converts a callback error into the errno reported to the kernel, which
+// is EIO unless the error carries a more specific one.
+func errnoOf(err error) uint16 {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return uint16(errno)
+	}
+	return uint16(syscall.EIO)
+}
@@ -0,0 +1,158 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package uhid
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karalabe/hid"
+)
+
+// vendor is a minimal vendor defined report descriptor with 8 byte input, output
+// and feature reports.
+var vendor = []byte{
+	0x06, 0x00, 0xff, 0x09, 0x01, 0xa1, 0x01, 0x15, 0x00, 0x26, 0xff, 0x00, 0x75, 0x08, 0x95, 0x08,
+	0x09, 0x01, 0x81, 0x02, 0x09, 0x02, 0x91, 0x02, 0x09, 0x03, 0xb1, 0x02, 0xc0,
+}
+
+// newTestDevice creates a virtual device, skipping the test if uhid is not
+// accessible.
+func newTestDevice(t *testing.T, config Config) *Device {
+	if _, err := os.Stat(Path); err != nil {
+		t.Skipf("uhid not available: %v", err)
+	}
+	dev, err := New(config)
+	if err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("uhid not accessible: %v", err)
+		}
+		t.Fatalf("failed to create virtual device: %v", err)
+	}
+	t.Cleanup(func() { dev.Close() })
+	return dev
+}
+
+// Tests that the events sent to the kernel are laid out as struct uhid_event.
+func TestCreateEvent(t *testing.T) {
+	dev := &Device{config: Config{
+		Name:       "Virtual",
+		Uniq:       "VIRT01",
+		BusType:    hid.BusBluetooth,
+		VendorID:   0x1209,
+		ProductID:  0x0001,
+		Descriptor: vendor,
+	}}
+	event := dev.create()
+	if len(event) != 4376 {
+		t.Fatalf("event size mismatch: have %d, want %d", len(event), 4376)
+	}
+	if kind := nativeEndian.Uint32(event); kind != eventCreate2 {
+		t.Errorf("event type mismatch: have %d, want %d", kind, eventCreate2)
+	}
+	req := event[4:]
+	if name := string(bytes.TrimRight(req[:128], "\x00")); name != "Virtual" {
+		t.Errorf("name mismatch: have %q, want %q", name, "Virtual")
+	}
+	if uniq := string(bytes.TrimRight(req[192:256], "\x00")); uniq != "VIRT01" {
+		t.Errorf("uniq mismatch: have %q, want %q", uniq, "VIRT01")
+	}
+	if size := nativeEndian.Uint16(req[256:]); int(size) != len(vendor) {
+		t.Errorf("descriptor size mismatch: have %d, want %d", size, len(vendor))
+	}
+	if bus := nativeEndian.Uint16(req[258:]); bus != linuxBusBluetooth {
+		t.Errorf("bus mismatch: have %#x, want %#x", bus, linuxBusBluetooth)
+	}
+	if !bytes.Equal(req[276:276+len(vendor)], vendor) {
+		t.Errorf("descriptor mismatch: have %x, want %x", req[276:276+len(vendor)], vendor)
+	}
+}
+
+// Tests that a virtual device is discovered by the hid package and that reports
+// flow in both directions through the kernel.
+func TestVirtualDevice(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		outputs [][]byte
+		sets    [][]byte
+	)
+	virt := newTestDevice(t, Config{
+		Name:       "Virtual Device",
+		Uniq:       "UHIDTEST01",
+		VendorID:   0x1209,
+		ProductID:  0x0d1d,
+		Descriptor: vendor,
+		OnOutput: func(report []byte) {
+			lock.Lock()
+			defer lock.Unlock()
+			outputs = append(outputs, report)
+		},
+		OnGetReport: func(kind ReportType, id byte) ([]byte, error) {
+			return []byte{id, 0xfe, 0xed}, nil
+		},
+		OnSetReport: func(kind ReportType, id byte, report []byte) error {
+			lock.Lock()
+			defer lock.Unlock()
+			sets = append(sets, report)
+			return nil
+		},
+	})
+	if !enumerable {
+		t.Skip("native hid backend does not see uhid devices")
+	}
+	// Wait for the kernel to expose the device and find it
+	var infos []hid.DeviceInfo
+	for start := time.Now(); time.Since(start) < 2*time.Second && len(infos) == 0; time.Sleep(10 * time.Millisecond) {
+		infos, _ = hid.EnumerateFilter(hid.Filter{VendorID: 0x1209, ProductID: 0x0d1d, Serial: "UHIDTEST01"})
+	}
+	if len(infos) != 1 {
+		t.Fatalf("virtual device not enumerated: %v", infos)
+	}
+	if infos[0].UsagePage != 0xff00 || infos[0].Usage != 0x01 {
+		t.Errorf("usage mismatch: have %#04x:%#04x, want 0xff00:0x0001", infos[0].UsagePage, infos[0].Usage)
+	}
+	dev, err := infos[0].Open()
+	if err != nil {
+		t.Fatalf("failed to open virtual device: %v", err)
+	}
+	defer dev.Close()
+
+	// Send an input report and read it back
+	input := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	if err := virt.Input(input); err != nil {
+		t.Fatalf("failed to send input report: %v", err)
+	}
+	buf := make([]byte, 64)
+	if n, err := dev.ReadTimeout(buf, 1000); err != nil || !bytes.Equal(buf[:n], input) {
+		t.Errorf("input mismatch: have %x, %v, want %x", buf[:n], err, input)
+	}
+	// Write output and feature reports, and request a feature report
+	if _, err := dev.Write([]byte{0x00, 0xaa, 0xbb}); err != nil {
+		t.Errorf("failed to write output report: %v", err)
+	}
+	if _, err := dev.SendFeatureReport([]byte{0x00, 0xcc}); err != nil {
+		t.Errorf("failed to send feature report: %v", err)
+	}
+	feature := make([]byte, 9)
+	if n, err := dev.GetFeatureReport(feature); err != nil || !bytes.Equal(feature[:n], []byte{0x00, 0xfe, 0xed}) {
+		t.Errorf("feature mismatch: have %x, %v, want %x", feature[:n], err, []byte{0x00, 0xfe, 0xed})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if want := [][]byte{{0x00, 0xaa, 0xbb}}; !reflect.DeepEqual(outputs, want) {
+		t.Errorf("outputs mismatch: have %x, want %x", outputs, want)
+	}
+	if want := [][]byte{{0x00, 0xcc}}; !reflect.DeepEqual(sets, want) {
+		t.Errorf("feature sets mismatch: have %x, want %x", sets, want)
+	}
+}
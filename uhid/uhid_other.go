@@ -0,0 +1,31 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+//go:build !linux
+// +build !linux
+
+package uhid
+
+import "github.com/karalabe/hid"
+
+// Device is a virtual HID device. On platforms that this file implements virtual
+// devices are not supported.
+type Device struct{}
+
+// New creates a virtual HID device. On platforms that this file implements the
+// function just returns an error.
+func New(config Config) (*Device, error) {
+	return nil, hid.ErrUnsupportedPlatform
+}
+
+// Input sends an input report from the virtual device to the kernel.
+func (d *Device) Input(report []byte) error {
+	return hid.ErrUnsupportedPlatform
+}
+
+// Close destroys the virtual device.
+func (d *Device) Close() error {
+	return nil
+}
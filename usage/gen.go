@@ -0,0 +1,137 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+//go:build ignore
+// +build ignore
+
+// This program generates tables.go from the HID Usage Tables transcribed into
+// tables.txt. It is invoked via go generate.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// page is a usage page as parsed from the source table.
+type page struct {
+	id     uint16
+	name   string
+	usages map[uint16]string
+	ranges []string
+}
+
+func main() {
+	in, err := os.Open("tables.txt")
+	if err != nil {
+		log.Fatalf("Failed to open usage tables: %v", err)
+	}
+	defer in.Close()
+
+	// Parse the source tables line by line
+	var (
+		pages   []*page
+		current *page
+		lineno  int
+	)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		lineno++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			log.Fatalf("Line %d: malformed entry: %q", lineno, line)
+		}
+		switch fields[0] {
+		case "page":
+			parts := strings.SplitN(fields[1], " ", 2)
+			if len(parts) != 2 {
+				log.Fatalf("Line %d: malformed page: %q", lineno, line)
+			}
+			current = &page{id: parseID(lineno, parts[0]), name: parts[1], usages: make(map[uint16]string)}
+			pages = append(pages, current)
+
+		case "range":
+			parts := strings.SplitN(fields[1], " ", 3)
+			if len(parts) != 3 || current == nil {
+				log.Fatalf("Line %d: malformed range: %q", lineno, line)
+			}
+			min, max := parseID(lineno, parts[0]), parseID(lineno, parts[1])
+			current.ranges = append(current.ranges, fmt.Sprintf("{%#04x, %#04x, %s}", min, max, strconv.Quote(parts[2])))
+
+		default:
+			if current == nil {
+				log.Fatalf("Line %d: usage outside of page: %q", lineno, line)
+			}
+			id := parseID(lineno, fields[0])
+			if _, ok := current.usages[id]; ok {
+				log.Fatalf("Line %d: duplicate usage %#04x", lineno, id)
+			}
+			current.usages[id] = fields[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Failed to read usage tables: %v", err)
+	}
+	// Generate the Go tables in a deterministic order
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf, "// Code generated by gen.go from tables.txt. DO NOT EDIT.")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "package usage")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "var pages = map[uint16]page{")
+
+	sort.Slice(pages, func(i, j int) bool { return pages[i].id < pages[j].id })
+	for _, p := range pages {
+		fmt.Fprintf(buf, "%#04x: {\n", p.id)
+		fmt.Fprintf(buf, "name: %s,\n", strconv.Quote(p.name))
+		if len(p.usages) > 0 {
+			ids := make([]int, 0, len(p.usages))
+			for id := range p.usages {
+				ids = append(ids, int(id))
+			}
+			sort.Ints(ids)
+
+			fmt.Fprintln(buf, "usages: map[uint16]string{")
+			for _, id := range ids {
+				fmt.Fprintf(buf, "%#04x: %s,\n", id, strconv.Quote(p.usages[uint16(id)]))
+			}
+			fmt.Fprintln(buf, "},")
+		}
+		if len(p.ranges) > 0 {
+			fmt.Fprintf(buf, "ranges: []namedRange{%s},\n", strings.Join(p.ranges, ", "))
+		}
+		fmt.Fprintln(buf, "},")
+	}
+	fmt.Fprintln(buf, "}")
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("Failed to format generated tables: %v", err)
+	}
+	if err := os.WriteFile("tables.go", source, 0644); err != nil {
+		log.Fatalf("Failed to write generated tables: %v", err)
+	}
+}
+
+// parseID parses a hexadecimal usage or page identifier.
+func parseID(lineno int, s string) uint16 {
+	id, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		log.Fatalf("Line %d: invalid identifier %q: %v", lineno, s, err)
+	}
+	return uint16(id)
+}
@@ -0,0 +1,77 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+// Package usage contains the USB HID Usage Tables, mapping usage pages and usage
+// IDs to their human readable names.
+package usage
+
+//go:generate go run gen.go
+
+import "fmt"
+
+// page is a single usage page from the HID Usage Tables.
+type page struct {
+	name   string            // Name of the usage page
+	usages map[uint16]string // Explicitly named usages
+	ranges []namedRange      // Usages named after their ID (e.g. Button N)
+}
+
+// namedRange is a range of usages whose names are derived from their IDs.
+type namedRange struct {
+	min    uint16 // First usage ID in the range
+	max    uint16 // Last usage ID in the range (inclusive)
+	format string // Format string to apply on the usage ID
+}
+
+// LookupPage returns the name of a usage page and whether it's known. Pages in
+// the vendor defined range (0xff00-0xffff) are reported as known.
+func LookupPage(page uint16) (string, bool) {
+	if p, ok := pages[page]; ok {
+		return p.name, true
+	}
+	if page >= 0xff00 {
+		return fmt.Sprintf("Vendor Defined %#04x", page), true
+	}
+	return "", false
+}
+
+// Lookup returns the name of a usage within a usage page and whether it's known.
+// Named array and range usages (e.g. Button N, Instance N) are resolved too.
+func Lookup(page uint16, id uint16) (string, bool) {
+	p, ok := pages[page]
+	if !ok {
+		return "", false
+	}
+	if name, ok := p.usages[id]; ok {
+		return name, true
+	}
+	for _, r := range p.ranges {
+		if id >= r.min && id <= r.max {
+			return fmt.Sprintf(r.format, id), true
+		}
+	}
+	return "", false
+}
+
+// PageName returns the name of a usage page, or a hex placeholder if the page
+// is not defined by the HID Usage Tables.
+func PageName(page uint16) string {
+	if name, ok := LookupPage(page); ok {
+		return name
+	}
+	return fmt.Sprintf("Reserved %#04x", page)
+}
+
+// Name returns the name of a usage within a usage page, or a hex placeholder if
+// the usage is not defined by the HID Usage Tables.
+func Name(page uint16, id uint16) string {
+	if name, ok := Lookup(page, id); ok {
+		return name
+	}
+	if page >= 0xff00 {
+		return fmt.Sprintf("Vendor Usage %#02x", id)
+	}
+	return fmt.Sprintf("Usage %#02x", id)
+}
@@ -0,0 +1,67 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package usage
+
+import "testing"
+
+// Tests that usage pages are resolved, including vendor defined ones.
+func TestPageName(t *testing.T) {
+	tests := []struct {
+		page uint16
+		name string
+	}{
+		{0x01, "Generic Desktop"},
+		{0x07, "Keyboard/Keypad"},
+		{0x0c, "Consumer"},
+		{0x20, "Sensors"},
+		{0x85, "Battery System"},
+		{0xf1d0, "FIDO Alliance"},
+		{0xff00, "Vendor Defined 0xff00"},
+		{0x13, "Reserved 0x0013"},
+	}
+	for _, tt := range tests {
+		if have := PageName(tt.page); have != tt.name {
+			t.Errorf("page %#04x: name mismatch: have %q, want %q", tt.page, have, tt.name)
+		}
+	}
+	if _, ok := LookupPage(0x13); ok {
+		t.Errorf("reserved page reported as known")
+	}
+}
+
+// Tests that usages are resolved, including named ranges.
+func TestName(t *testing.T) {
+	tests := []struct {
+		page uint16
+		id   uint16
+		name string
+	}{
+		{0x01, 0x02, "Mouse"},
+		{0x01, 0x30, "X"},
+		{0x07, 0x04, "Keyboard a and A"},
+		{0x07, 0xe1, "Keyboard LeftShift"},
+		{0x08, 0x02, "Caps Lock"},
+		{0x09, 0x00, "No Button Pressed"},
+		{0x09, 0x05, "Button 5"},
+		{0x0a, 0x03, "Instance 3"},
+		{0x0c, 0xcd, "Play/Pause"},
+		{0x0c, 0x238, "AC Pan"},
+		{0x0d, 0x42, "Tip Switch"},
+		{0x10, 0x41, "U+0041"},
+		{0x84, 0x30, "Voltage"},
+		{0xf1d0, 0x01, "U2F Authenticator Device"},
+		{0xff00, 0x01, "Vendor Usage 0x01"},
+		{0x01, 0x2f, "Usage 0x2f"},
+	}
+	for _, tt := range tests {
+		if have := Name(tt.page, tt.id); have != tt.name {
+			t.Errorf("usage %#04x:%#04x: name mismatch: have %q, want %q", tt.page, tt.id, have, tt.name)
+		}
+	}
+	if _, ok := Lookup(0x01, 0x2f); ok {
+		t.Errorf("reserved usage reported as known")
+	}
+}
@@ -0,0 +1,211 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// watchPollInterval is the interval at which the attached devices are polled for
+// changes. If native hotplug notifications are available, changes are detected
+// immediately and polling only acts as a safety net.
+const watchPollInterval = time.Second
+
+// EventType is the kind of change a hotplug event reports.
+type EventType int
+
+const (
+	Arrived EventType = iota + 1 // A matching device was attached
+	Removed                      // A matching device was detached
+)
+
+// String implements fmt.Stringer.
+func (t EventType) String() string {
+	switch t {
+	case Arrived:
+		return "arrived"
+	case Removed:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a hotplug notification about a device arriving or being removed.
+type Event struct {
+	Type EventType  // Whether the device arrived or was removed
+	Info DeviceInfo // Details of the device, as enumerated when it arrived
+}
+
+// Watch monitors the system for HID devices matching the filter, emitting an
+// Arrived event for every device already attached, followed by Arrived and
+// Removed events as devices come and go. The channel is closed when the context
+// is cancelled.
+//
+// On Linux, kernel hotplug notifications are used to detect changes immediately,
+// as are the notifications of registered backends implementing Notifier. On other
+// platforms, or if those are not accessible, the devices are polled.
+func Watch(ctx context.Context, filter Filter) (<-chan Event, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	w := &watcher{
+		filter:    filter,
+		enumerate: enumerateAvailable,
+		trigger:   notifications(ctx),
+		interval:  watchPollInterval,
+		stop:      cancel,
+	}
+	events, err := w.start(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return events, nil
+}
+
+// notifications subscribes to the change notifications of all the backends that
+// support them, merging them into a single channel. Nil is returned if none do.
+func notifications(ctx context.Context) <-chan struct{} {
+	var sources []<-chan struct{}
+	for _, active := range activeBackends() {
+		if notifier, ok := active.backend.(Notifier); ok {
+			if source, err := notifier.Notify(ctx); err == nil {
+				sources = append(sources, source)
+			}
+		}
+	}
+	switch len(sources) {
+	case 0:
+		return nil
+	case 1:
+		return sources[0]
+	}
+	merged := make(chan struct{}, 1)
+
+	var pend sync.WaitGroup
+	for _, source := range sources {
+		pend.Add(1)
+		go func(source <-chan struct{}) {
+			defer pend.Done()
+			for range source {
+				select {
+				case merged <- struct{}{}:
+				default: // Change already signalled, coalesce
+				}
+			}
+		}(source)
+	}
+	go func() {
+		pend.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+// watcher is a diffing device monitor, re-enumerating the attached devices when
+// native notifications signal a change, or periodically as a fallback.
+type watcher struct {
+	filter    Filter                                     // Filter selecting the devices to report
+	enumerate func(uint16, uint16) ([]DeviceInfo, error) // Enumerator listing the attached devices
+	trigger   <-chan struct{}                            // Native change notifications, nil if unavailable
+	interval  time.Duration                              // Interval to poll for changes at
+	stop      func()                                     // Callback to release resources when done
+}
+
+// scan enumerates the currently attached devices matching the filter.
+func (w *watcher) scan() (map[string]DeviceInfo, error) {
+	infos, err := w.enumerate(w.filter.VendorID, w.filter.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	devices := make(map[string]DeviceInfo)
+	for _, info := range infos {
+		if w.filter.Match(info) {
+			devices[info.Path] = info
+		}
+	}
+	return devices, nil
+}
+
+// start enumerates the initial set of devices and starts monitoring for changes
+// until the context is cancelled.
+func (w *watcher) start(ctx context.Context) (<-chan Event, error) {
+	known, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event, len(known))
+	for _, info := range sortedInfos(known) {
+		events <- Event{Type: Arrived, Info: info}
+	}
+	go w.loop(ctx, known, events)
+	return events, nil
+}
+
+// loop monitors the attached devices for changes, emitting an event for every
+// arrival and removal.
+func (w *watcher) loop(ctx context.Context, known map[string]DeviceInfo, events chan<- Event) {
+	defer close(events)
+	if w.stop != nil {
+		defer w.stop()
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	trigger := w.trigger
+	for {
+		// Wait until a change is signalled or it's time to poll anyway
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case _, ok := <-trigger:
+			if !ok {
+				trigger = nil // Native notifications died, rely on polling
+				continue
+			}
+		}
+		current, err := w.scan()
+		if err != nil {
+			continue // Transient enumeration failure, retry on the next round
+		}
+		// Report all the removed and arrived devices
+		var diff []Event
+		for _, info := range sortedInfos(known) {
+			if _, ok := current[info.Path]; !ok {
+				diff = append(diff, Event{Type: Removed, Info: info})
+			}
+		}
+		for _, info := range sortedInfos(current) {
+			if _, ok := known[info.Path]; !ok {
+				diff = append(diff, Event{Type: Arrived, Info: info})
+			}
+		}
+		known = current
+
+		for _, event := range diff {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// sortedInfos returns the devices from a path indexed set ordered by path, so
+// that events are emitted deterministically.
+func sortedInfos(devices map[string]DeviceInfo) []DeviceInfo {
+	infos := make([]DeviceInfo, 0, len(devices))
+	for _, info := range devices {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos
+}
@@ -0,0 +1,85 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"bytes"
+	"context"
+	"syscall"
+	"time"
+)
+
+// hotplugSubsystems are the kernel subsystems whose uevents may signal a change
+// in the set of attached HID devices.
+var hotplugSubsystems = [][]byte{
+	[]byte("SUBSYSTEM=hidraw"),
+	[]byte("SUBSYSTEM=hid"),
+	[]byte("SUBSYSTEM=usb"),
+}
+
+// hotplugEvents subscribes to the kernel's uevent netlink broadcasts, signalling
+// on the returned channel whenever a HID related device is added or removed. The
+// channel is closed when the context is cancelled or the socket fails.
+func hotplugEvents(ctx context.Context) (<-chan struct{}, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	// Wake up periodically to check for context cancellation
+	timeout := syscall.NsecToTimeval(int64(250 * time.Millisecond))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	trigger := make(chan struct{}, 1)
+	go func() {
+		defer close(trigger)
+		defer syscall.Close(fd)
+
+		buf := make([]byte, 16384)
+		for ctx.Err() == nil {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if err == syscall.EAGAIN || err == syscall.EINTR {
+					continue
+				}
+				return
+			}
+			if !isHotplugEvent(buf[:n]) {
+				continue
+			}
+			// Coalesce bursts of events into a single pending signal
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return trigger, nil
+}
+
+// isHotplugEvent checks whether a raw uevent message is an addition or removal of
+// a device in a subsystem relevant to HID enumeration.
+func isHotplugEvent(msg []byte) bool {
+	var action, subsystem bool
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		switch {
+		case bytes.Equal(field, []byte("ACTION=add")) || bytes.Equal(field, []byte("ACTION=remove")):
+			action = true
+		default:
+			for _, sub := range hotplugSubsystems {
+				if bytes.Equal(field, sub) {
+					subsystem = true
+				}
+			}
+		}
+	}
+	return action && subsystem
+}
@@ -0,0 +1,31 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tests that only additions and removals in HID related subsystems are treated
+// as hotplug events.
+func TestIsHotplugEvent(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   bool
+	}{
+		{[]string{"add@/devices/hidraw/hidraw3", "ACTION=add", "SUBSYSTEM=hidraw", "DEVNAME=hidraw3"}, true},
+		{[]string{"remove@/devices/usb1/1-2", "ACTION=remove", "SUBSYSTEM=usb", "DEVTYPE=usb_device"}, true},
+		{[]string{"change@/devices/hidraw/hidraw3", "ACTION=change", "SUBSYSTEM=hidraw"}, false},
+		{[]string{"add@/devices/net/eth1", "ACTION=add", "SUBSYSTEM=net"}, false},
+		{[]string{"libudev", "ACTION=add"}, false},
+	}
+	for i, tt := range tests {
+		if have := isHotplugEvent([]byte(strings.Join(tt.fields, "\x00"))); have != tt.want {
+			t.Errorf("test %d: match mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+//go:build !linux
+// +build !linux
+
+package hid
+
+import (
+	"context"
+	"errors"
+)
+
+// hotplugEvents would subscribe to native hotplug notifications, but they are not
+// supported on this platform, so changes are detected by polling only.
+func hotplugEvents(ctx context.Context) (<-chan struct{}, error) {
+	return nil, errors.New("hid: native hotplug notifications not supported")
+}
@@ -0,0 +1,131 @@
+// hid - Gopher Interface Devices (USB HID)
+// Copyright (c) 2017 Péter Szilágyi. All rights reserved.
+//
+// This file is released under the 3-clause BSD license.
+
+package hid
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEnumerator is a mutable device list to inject into watchers.
+type fakeEnumerator struct {
+	devices []DeviceInfo
+	lock    sync.Mutex
+}
+
+func (e *fakeEnumerator) set(devices ...DeviceInfo) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.devices = devices
+}
+
+func (e *fakeEnumerator) enumerate(vendorID uint16, productID uint16) ([]DeviceInfo, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]DeviceInfo{}, e.devices...), nil
+}
+
+// expectEvent waits for the next event and checks that it matches the expected one.
+func expectEvent(t *testing.T, events <-chan Event, kind EventType, path string) {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatalf("event channel closed, want %v %s", kind, path)
+		}
+		if event.Type != kind || event.Info.Path != path {
+			t.Fatalf("event mismatch: have %v %s, want %v %s", event.Type, event.Info.Path, kind, path)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for %v %s", kind, path)
+	}
+}
+
+// Tests that the watcher reports the initially attached devices, and then the
+// arrivals and removals signalled by native notifications, filtered.
+func TestWatchTrigger(t *testing.T) {
+	var (
+		wallet = DeviceInfo{Path: "a", VendorID: 0x1209}
+		other  = DeviceInfo{Path: "b", VendorID: 0x2c97}
+		second = DeviceInfo{Path: "c", VendorID: 0x1209}
+	)
+	enumerator := new(fakeEnumerator)
+	enumerator.set(wallet, other)
+
+	trigger := make(chan struct{})
+	w := &watcher{
+		filter:    Filter{VendorID: 0x1209},
+		enumerate: enumerator.enumerate,
+		trigger:   trigger,
+		interval:  time.Hour,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := w.start(ctx)
+	if err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	expectEvent(t, events, Arrived, "a")
+
+	enumerator.set(other, second)
+	trigger <- struct{}{}
+	expectEvent(t, events, Removed, "a")
+	expectEvent(t, events, Arrived, "c")
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatalf("unexpected event after cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("event channel not closed after cancellation")
+	}
+}
+
+// Tests that the watcher falls back to polling if native notifications are not
+// available, or stop working.
+func TestWatchPoll(t *testing.T) {
+	enumerator := new(fakeEnumerator)
+
+	trigger := make(chan struct{})
+	close(trigger)
+
+	w := &watcher{
+		enumerate: enumerator.enumerate,
+		trigger:   trigger,
+		interval:  10 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := w.start(ctx)
+	if err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	enumerator.set(DeviceInfo{Path: "a"})
+	expectEvent(t, events, Arrived, "a")
+
+	enumerator.set()
+	expectEvent(t, events, Removed, "a")
+}
+
+// Tests that a failing initial enumeration is reported to the caller.
+func TestWatchFailure(t *testing.T) {
+	failure := errors.New("enumeration failed")
+	w := &watcher{
+		enumerate: func(uint16, uint16) ([]DeviceInfo, error) { return nil, failure },
+		interval:  time.Hour,
+	}
+	if _, err := w.start(context.Background()); err != failure {
+		t.Errorf("error mismatch: have %v, want %v", err, failure)
+	}
+}